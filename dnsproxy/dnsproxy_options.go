@@ -0,0 +1,57 @@
+package dnsproxy
+
+import (
+	"gopkg.in/n.v0/dnssec"
+)
+
+const DefaultAddress = "127.0.0.1:53"
+
+type config struct {
+	address       string
+	dnsResolver   dnssec.DNSResolver
+	trustAnchors  dnssec.KeySet
+	dnssecOptions []dnssec.Option
+	validator     *dnssec.Resolver
+}
+
+type Option func(*config)
+
+// WithAddress sets the host and port the server listens on for both UDP and
+// TCP. The default is DefaultAddress.
+func WithAddress(address string) Option {
+	return func(c *config) {
+		c.address = address
+	}
+}
+
+// WithDNSResolver sets the resolver queries are forwarded to. The default is
+// a doh.Resolver using its default servers. It is not used with WithValidator.
+func WithDNSResolver(resolver dnssec.DNSResolver) Option {
+	return func(c *config) {
+		c.dnsResolver = resolver
+	}
+}
+
+// WithTrustAnchors sets the root keys of the dnssec.Resolver validating the
+// answers of the forwarding resolver.
+func WithTrustAnchors(keys dnssec.KeySet) Option {
+	return func(c *config) {
+		c.trustAnchors = keys
+	}
+}
+
+// WithDNSSECOptions passes further options to the validating dnssec.Resolver.
+func WithDNSSECOptions(options ...dnssec.Option) Option {
+	return func(c *config) {
+		c.dnssecOptions = append(c.dnssecOptions, options...)
+	}
+}
+
+// WithValidator uses an existing dnssec.Resolver for validation instead of
+// creating one from the trust anchors. Queries with the CD bit set are then
+// forwarded to the upstream resolver of the validator.
+func WithValidator(validator *dnssec.Resolver) Option {
+	return func(c *config) {
+		c.validator = validator
+	}
+}
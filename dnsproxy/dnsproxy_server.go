@@ -0,0 +1,141 @@
+// Package dnsproxy serves DNS over UDP and TCP, forwarding queries to another
+// resolver such as a doh.Resolver and validating the answers with DNSSEC, so
+// that unmodified applications get both by pointing at a local address.
+package dnsproxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/doh"
+)
+
+type Server struct {
+	config
+
+	mutex   sync.Mutex
+	servers []*dns.Server
+}
+
+func New(options ...Option) (server *Server, err error) {
+	server = new(Server)
+	for _, opt := range options {
+		opt(&server.config)
+	}
+	if server.address == "" {
+		server.address = DefaultAddress
+	}
+	if server.dnsResolver == nil {
+		if server.dnsResolver, err = doh.New(); err != nil {
+			return
+		}
+	}
+	if server.validator == nil {
+		if len(server.trustAnchors) < 1 {
+			err = fmt.Errorf("no DNSSEC trust anchor keys or validator provided for creating DNS proxy")
+			return
+		}
+		options := append([]dnssec.Option{
+			dnssec.WithTrustAnchors(server.trustAnchors),
+			dnssec.WithDNSResolver(server.dnsResolver),
+		}, server.dnssecOptions...)
+		if server.validator, err = dnssec.New(options...); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ListenAndServe listens on the configured address over UDP and TCP and
+// serves queries until Shutdown is called.
+func (server *Server) ListenAndServe() (err error) {
+	packetConn, err := net.ListenPacket("udp", server.address)
+	if err != nil {
+		return
+	}
+	listener, err := net.Listen("tcp", server.address)
+	if err != nil {
+		packetConn.Close()
+		return
+	}
+	return server.Serve(packetConn, listener)
+}
+
+// Serve answers queries received on packetConn and listener until Shutdown is
+// called.
+func (server *Server) Serve(packetConn net.PacketConn, listener net.Listener) (err error) {
+	udp := &dns.Server{PacketConn: packetConn, Handler: server}
+	tcp := &dns.Server{Listener: listener, Handler: server}
+	server.mutex.Lock()
+	server.servers = append(server.servers, udp, tcp)
+	server.mutex.Unlock()
+
+	errs := make(chan error, 2)
+	go func() { errs <- udp.ActivateAndServe() }()
+	go func() { errs <- tcp.ActivateAndServe() }()
+	err = <-errs
+	server.Shutdown()
+	if err2 := <-errs; err == nil {
+		err = err2
+	}
+	return
+}
+
+func (server *Server) Shutdown() (err error) {
+	server.mutex.Lock()
+	servers := server.servers
+	server.servers = nil
+	server.mutex.Unlock()
+	for _, s := range servers {
+		if err2 := s.Shutdown(); err == nil {
+			err = err2
+		}
+	}
+	return
+}
+
+func (server *Server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp, _ := server.Query(req)
+	if _, ok := w.LocalAddr().(*net.UDPAddr); ok {
+		size := dns.MinMsgSize
+		if opt := req.IsEdns0(); opt != nil && int(opt.UDPSize()) > size {
+			size = int(opt.UDPSize())
+		}
+		resp.Truncate(size)
+	}
+	w.WriteMsg(resp)
+}
+
+// Query answers req with the validator, see dnssec.Resolver.Query. Bogus and
+// Indeterminate answers are answered with SERVFAIL and an Extended DNS Error
+// ([rfc8914]), which is also returned as err.
+func (server *Server) Query(req *dns.Msg) (resp *dns.Msg, err error) {
+	if resp, err = server.validator.Query(req); err == nil {
+		return
+	}
+	resp = new(dns.Msg)
+	resp.SetReply(req)
+	resp.RecursionAvailable = true
+	if len(req.Question) != 1 {
+		resp.Rcode = dns.RcodeFormatError
+		return
+	}
+	resp.Rcode = dns.RcodeServerFailure
+	code := uint16(dns.ExtendedErrorCodeNetworkError)
+	switch {
+	case errors.Is(err, dnssec.ErrBogus):
+		code = dns.ExtendedErrorCodeDNSBogus
+	case errors.Is(err, dnssec.ErrIndeterminate):
+		code = dns.ExtendedErrorCodeDNSSECIndeterminate
+	}
+	if opt := req.IsEdns0(); opt != nil {
+		resp.SetEdns0(4096, opt.Do())
+		opt := resp.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: code, ExtraText: err.Error()})
+	}
+	return
+}
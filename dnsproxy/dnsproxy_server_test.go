@@ -0,0 +1,75 @@
+package dnsproxy_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnsproxy"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestServer(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add("www 300 IN A 192.0.2.1")
+	tree.AddZone("broken.").Add("www 300 IN A 192.0.2.2").Bogus = true
+
+	server, err := dnsproxy.New(
+		dnsproxy.WithDNSResolver(tree),
+		dnsproxy.WithTrustAnchors(tree.TrustAnchors()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	if err != nil {
+		t.Skip(err)
+	}
+	go server.Serve(packetConn, listener)
+	defer server.Shutdown()
+
+	for _, network := range []string{"udp", "tcp"} {
+		client := &dns.Client{Net: network}
+		exchange := func(name string, cd bool) *dns.Msg {
+			msg := new(dns.Msg)
+			msg.SetQuestion(name, dns.TypeA)
+			msg.SetEdns0(4096, true)
+			msg.CheckingDisabled = cd
+			resp, _, err := client.Exchange(msg, packetConn.LocalAddr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return resp
+		}
+
+		resp := exchange("www.example.", false)
+		if resp.Rcode != dns.RcodeSuccess || !resp.AuthenticatedData || len(resp.Answer) == 0 {
+			t.Errorf("%s: expected secure answer with AD bit, got %v", network, resp)
+		}
+
+		resp = exchange("www.broken.", false)
+		if resp.Rcode != dns.RcodeServerFailure {
+			t.Errorf("%s: expected SERVFAIL for bogus answer, got %v", network, resp)
+		}
+		var ede *dns.EDNS0_EDE
+		if opt := resp.IsEdns0(); opt != nil {
+			for _, o := range opt.Option {
+				if e, ok := o.(*dns.EDNS0_EDE); ok {
+					ede = e
+				}
+			}
+		}
+		if ede == nil || ede.InfoCode != dns.ExtendedErrorCodeDNSBogus {
+			t.Errorf("%s: expected DNSSEC Bogus extended error, got %v", network, resp)
+		}
+
+		resp = exchange("www.broken.", true)
+		if resp.Rcode != dns.RcodeSuccess || resp.AuthenticatedData || len(resp.Answer) == 0 {
+			t.Errorf("%s: expected unvalidated answer with CD bit, got %v", network, resp)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package caa decides whether a CA may issue certificates for a domain name
+// from its CAA records as described in [rfc8659], including the account and
+// validation method bindings of [rfc8657], looked up through a validating
+// dnssec.Resolver.
+package caa
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+)
+
+// Request describes a certificate to be issued for one domain name.
+type Request struct {
+	// Domain is the FQDN, or a wildcard domain name starting with "*.".
+	Domain string
+	// AccountURI is the ACME account of the applicant, see [rfc8657] 3.
+	AccountURI string
+	// ValidationMethod is the label of the ACME challenge type used, e.g.
+	// "dns-01", see [rfc8657] 4.
+	ValidationMethod string
+}
+
+// Decision is the outcome of evaluating the CAA records of a Request.
+type Decision struct {
+	Allowed bool
+	// Reason explains the decision.
+	Reason string
+	// Name is the owner of the Relevant RRset, empty if there is none.
+	Name string
+	// Records are the Relevant RRset.
+	Records []*dns.CAA
+	// Status is Secure only if every lookup made while climbing the tree
+	// was.
+	Status dnssec.SecurityStatus
+	// IODEF are the URLs of iodef properties to report refusals to, see
+	// [rfc8659] 4.4.
+	IODEF []*url.URL
+}
+
+// Evaluator evaluates CAA records for a CA.
+type Evaluator struct {
+	config
+	resolver *dnssec.Resolver
+}
+
+func New(resolver *dnssec.Resolver, options ...Option) (evaluator *Evaluator, err error) {
+	evaluator = &Evaluator{resolver: resolver}
+	for _, opt := range options {
+		opt(&evaluator.config)
+	}
+	if resolver == nil {
+		err = fmt.Errorf("no DNSSEC resolver provided for creating CAA evaluator")
+		return
+	}
+	if len(evaluator.issuerDomainNames) == 0 {
+		err = fmt.Errorf("no issuer domain names provided for creating CAA evaluator")
+		return
+	}
+	return
+}
+
+// RelevantRRset returns the CAA records of the closest name at or above
+// domain that has any, following CNAMEs, up to but not including the root,
+// see [rfc8659] 3. Failed lookups are errors, since a CA must not issue
+// without the records.
+func (evaluator *Evaluator) RelevantRRset(domain string) (name string, records []*dns.CAA, status dnssec.SecurityStatus, err error) {
+	labels := dns.SplitDomainName(domain)
+	for i := range labels {
+		name = dns.Fqdn(strings.Join(labels[i:], "."))
+		rrs, rrsStatus, lookupErr := evaluator.resolver.LookupRRs(name, dns.TypeCAA)
+		if dnssec.IgnoreNotFound(lookupErr) != nil {
+			err = fmt.Errorf("failed to look up CAA records of %s: %w", name, lookupErr)
+			name, status = "", lookupErr
+			return
+		}
+		if rrsStatus != dnssec.Secure {
+			status = rrsStatus
+		}
+		for _, rr := range rrs {
+			records = append(records, rr.(*dns.CAA))
+		}
+		if len(records) > 0 {
+			return
+		}
+	}
+	name = ""
+	return
+}
+
+// Evaluate decides whether the CA may issue a certificate for req. Errors
+// are failed lookups, which have to be treated as a refusal.
+func (evaluator *Evaluator) Evaluate(req Request) (decision Decision, err error) {
+	domain := dns.CanonicalName(req.Domain)
+	wildcard := strings.HasPrefix(domain, "*.")
+	if wildcard {
+		domain = domain[2:]
+	}
+	decision.Name, decision.Records, decision.Status, err = evaluator.RelevantRRset(domain)
+	if err != nil {
+		decision.Reason = "CAA lookup failed"
+		return
+	}
+	if len(decision.Records) == 0 {
+		decision.Allowed, decision.Reason = true, "no CAA records"
+		return
+	}
+
+	var issue, issueWild []*dns.CAA
+	for _, caa := range decision.Records {
+		switch strings.ToLower(caa.Tag) {
+		case TagIssue:
+			issue = append(issue, caa)
+		case TagIssueWild:
+			issueWild = append(issueWild, caa)
+		case TagIODEF:
+			if u, parseErr := url.Parse(caa.Value); parseErr == nil {
+				decision.IODEF = append(decision.IODEF, u)
+			}
+		}
+		if Critical(caa) && !Known(caa.Tag) {
+			decision.Reason = fmt.Sprintf("unknown critical property %s", caa.Tag)
+			return
+		}
+	}
+	// [rfc8659] 4.3. issuewild properties take precedence for wildcards
+	properties, tag := issue, TagIssue
+	if wildcard && len(issueWild) > 0 {
+		properties, tag = issueWild, TagIssueWild
+	}
+	if len(properties) == 0 {
+		decision.Allowed, decision.Reason = true, fmt.Sprintf("no %s properties", tag)
+		return
+	}
+	for _, caa := range properties {
+		if evaluator.authorizes(caa, req) {
+			decision.Allowed = true
+			decision.Reason = fmt.Sprintf("authorized by %s property %q", tag, caa.Value)
+			return
+		}
+	}
+	decision.Reason = fmt.Sprintf("not authorized by any %s property", tag)
+	return
+}
+
+// authorizes reports whether the issue or issuewild property caa names the
+// CA and its parameters admit req. Properties that do not parse authorize
+// nothing.
+func (evaluator *Evaluator) authorizes(caa *dns.CAA, req Request) bool {
+	v, err := ParseIssueValue(caa.Value)
+	if err != nil || v.IssuerDomainName == "" {
+		return false
+	}
+	issuer := dns.CanonicalName(v.IssuerDomainName)
+	found := false
+	for _, name := range evaluator.issuerDomainNames {
+		found = found || name == issuer
+	}
+	if !found {
+		return false
+	}
+	if accountURI, ok := v.Get(ParameterAccountURI); ok && accountURI != req.AccountURI {
+		return false
+	}
+	if methods, ok := v.Get(ParameterValidationMethods); ok {
+		allowed := false
+		for _, method := range strings.Split(methods, ",") {
+			allowed = allowed || method == req.ValidationMethod && method != ""
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
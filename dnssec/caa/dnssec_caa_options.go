@@ -0,0 +1,21 @@
+package caa
+
+import (
+	"github.com/miekg/dns"
+)
+
+type config struct {
+	issuerDomainNames []string
+}
+
+type Option func(*config)
+
+// WithIssuerDomainNames sets the domain names identifying the CA in issue
+// and issuewild properties, see [rfc8659] 4.2. At least one is required.
+func WithIssuerDomainNames(names ...string) Option {
+	return func(c *config) {
+		for _, name := range names {
+			c.issuerDomainNames = append(c.issuerDomainNames, dns.CanonicalName(name))
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package caa
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Property tags defined in [rfc8659] 4 and by the CA/Browser Forum.
+const (
+	TagIssue        = "issue"
+	TagIssueWild    = "issuewild"
+	TagIODEF        = "iodef"
+	TagContactEmail = "contactemail"
+	TagContactPhone = "contactphone"
+)
+
+// Parameters defined in [rfc8657] 3 and 4.
+const (
+	ParameterAccountURI        = "accounturi"
+	ParameterValidationMethods = "validationmethods"
+)
+
+// FlagCritical is the Issuer Critical Flag of [rfc8659] 4.1.
+const FlagCritical uint8 = 128
+
+// Critical reports whether caa has the Issuer Critical Flag set.
+func Critical(caa *dns.CAA) bool {
+	return caa.Flag&FlagCritical != 0
+}
+
+// Known reports whether the CA understands tag. Critical properties with
+// unknown tags forbid issuance, see [rfc8659] 4.1.
+func Known(tag string) bool {
+	switch strings.ToLower(tag) {
+	case TagIssue, TagIssueWild, TagIODEF, TagContactEmail, TagContactPhone:
+		return true
+	}
+	return false
+}
+
+// Parameter is a tag and value pair of an issue or issuewild property.
+type Parameter struct {
+	Tag   string
+	Value string
+}
+
+// IssueValue is the parsed value of an issue or issuewild property.
+type IssueValue struct {
+	// IssuerDomainName is the CA authorized, empty if the property
+	// authorizes none.
+	IssuerDomainName string
+	Parameters       []Parameter
+}
+
+// Get returns the value of the parameter tag and whether it is present.
+func (v IssueValue) Get(tag string) (value string, ok bool) {
+	for _, p := range v.Parameters {
+		if p.Tag == tag {
+			return p.Value, true
+		}
+	}
+	return
+}
+
+// ParseIssueValue parses the value of an issue or issuewild property
+// following the grammar of [rfc8659] 4.2.
+func ParseIssueValue(value string) (v IssueValue, err error) {
+	parts := strings.Split(value, ";")
+	v.IssuerDomainName = strings.TrimSpace(parts[0])
+	if v.IssuerDomainName != "" && !issuerDomainName(v.IssuerDomainName) {
+		err = fmt.Errorf("invalid issuer domain name %q", v.IssuerDomainName)
+		return
+	}
+	for i, part := range parts[1:] {
+		part = strings.TrimSpace(part)
+		if part == "" && i == len(parts)-2 {
+			// a trailing separator without parameters
+			break
+		}
+		eq := strings.IndexByte(part, '=')
+		if eq < 0 {
+			err = fmt.Errorf("invalid parameter %q", part)
+			return
+		}
+		p := Parameter{Tag: strings.TrimSpace(part[:eq]), Value: strings.TrimSpace(part[eq+1:])}
+		if !parameterTag(p.Tag) || !parameterValue(p.Value) {
+			err = fmt.Errorf("invalid parameter %q", part)
+			return
+		}
+		v.Parameters = append(v.Parameters, p)
+	}
+	return
+}
+
+func issuerDomainName(name string) bool {
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return false
+		}
+		for _, c := range label {
+			if !alphanumeric(c) && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func parameterTag(tag string) bool {
+	if tag == "" || !alphanumeric(rune(tag[0])) || !alphanumeric(rune(tag[len(tag)-1])) {
+		return false
+	}
+	for _, c := range tag {
+		if !alphanumeric(c) && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func parameterValue(value string) bool {
+	for _, c := range value {
+		if c < 0x21 || c > 0x7e || c == ';' {
+			return false
+		}
+	}
+	return true
+}
+
+func alphanumeric(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,93 @@
+package caa_test
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/dnssec/caa"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestParseIssueValue(t *testing.T) {
+	v, err := caa.ParseIssueValue(" ca.example ; accounturi=https://ca.example/acct/1;validationmethods = dns-01,http-01 ;")
+	if err != nil || v.IssuerDomainName != "ca.example" || len(v.Parameters) != 2 {
+		t.Fatalf("unexpected value %+v %v", v, err)
+	}
+	if methods, ok := v.Get(caa.ParameterValidationMethods); !ok || methods != "dns-01,http-01" {
+		t.Errorf("unexpected validation methods %q", methods)
+	}
+	if v, err = caa.ParseIssueValue(";"); err != nil || v.IssuerDomainName != "" {
+		t.Errorf("expected value authorizing no CA, got %+v %v", v, err)
+	}
+	for _, value := range []string{"ca..example", "ca.example; accounturi", "ca.example; -a=b"} {
+		if _, err = caa.ParseIssueValue(value); err == nil {
+			t.Errorf("expected %q to fail", value)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add(
+		`example. 300 IN CAA 0 issue "ca.example; accounturi=https://ca.example/acct/1; validationmethods=dns-01"`,
+		`example. 300 IN CAA 0 issuewild ";"`,
+		`example. 300 IN CAA 0 iodef "mailto:security@example."`,
+		`other 300 IN CAA 0 issue "other.example"`,
+		`alias 300 IN CNAME other.example.`,
+		`critical 300 IN CAA 128 tbs "unknown"`,
+		`critical 300 IN CAA 0 issue "ca.example"`,
+	)
+	tree.AddZone("open.").Add("www 300 IN A 192.0.2.1").Unsigned = true
+	tree.AddZone("broken.").Add(`broken. 300 IN CAA 0 issue "ca.example"`).Bogus = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = caa.New(resolver); err == nil {
+		t.Error("expected evaluator without issuer domain names to fail")
+	}
+	evaluator, err := caa.New(resolver, caa.WithIssuerDomainNames("CA.example."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := "https://ca.example/acct/1"
+	for _, test := range []struct {
+		req     caa.Request
+		allowed bool
+		name    string
+	}{
+		{caa.Request{Domain: "www.sub.example.", AccountURI: account, ValidationMethod: "dns-01"}, true, "example."},
+		{caa.Request{Domain: "www.example.", AccountURI: "https://ca.example/acct/2", ValidationMethod: "dns-01"}, false, "example."},
+		{caa.Request{Domain: "www.example.", AccountURI: account, ValidationMethod: "http-01"}, false, "example."},
+		{caa.Request{Domain: "*.example.", AccountURI: account, ValidationMethod: "dns-01"}, false, "example."},
+		{caa.Request{Domain: "other.example."}, false, "other.example."},
+		{caa.Request{Domain: "alias.example."}, false, "alias.example."},
+		{caa.Request{Domain: "critical.example."}, false, "critical.example."},
+		{caa.Request{Domain: "www.open."}, true, ""},
+	} {
+		decision, err := evaluator.Evaluate(test.req)
+		if err != nil {
+			t.Errorf("%s: %v", test.req.Domain, err)
+			continue
+		}
+		if decision.Allowed != test.allowed || decision.Name != test.name {
+			t.Errorf("%s: expected allowed %v by %q, got %+v", test.req.Domain, test.allowed, test.name, decision)
+		}
+	}
+
+	decision, err := evaluator.Evaluate(caa.Request{Domain: "www.example.", AccountURI: account, ValidationMethod: "dns-01"})
+	if err != nil || decision.Status != dnssec.Secure || len(decision.Records) != 3 || len(decision.IODEF) != 1 {
+		t.Errorf("expected Secure records with iodef URL, got %+v %v", decision, err)
+	}
+	if decision, err = evaluator.Evaluate(caa.Request{Domain: "www.open."}); err != nil || !errors.Is(decision.Status, dnssec.ErrInsecure) {
+		t.Errorf("expected Insecure status, got %+v %v", decision, err)
+	}
+	if decision, err = evaluator.Evaluate(caa.Request{Domain: "broken."}); !errors.Is(err, dnssec.ErrBogus) || decision.Allowed {
+		t.Errorf("expected Bogus records to refuse issuance, got %+v %v", decision, err)
+	}
+}
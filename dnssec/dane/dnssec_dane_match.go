@@ -0,0 +1,215 @@
+// Package dane authenticates TLS servers with TLSA records from DNSSEC
+// validated zones as described in [rfc6698] and [rfc7671].
+package dane
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Certificate usages, selectors and matching types of TLSA records, see
+// [rfc6698] 2.1 and [rfc7218].
+const (
+	UsagePKIXTA uint8 = 0
+	UsagePKIXEE uint8 = 1
+	UsageDANETA uint8 = 2
+	UsageDANEEE uint8 = 3
+
+	SelectorCert uint8 = 0
+	SelectorSPKI uint8 = 1
+
+	MatchingFull   uint8 = 0
+	MatchingSHA256 uint8 = 1
+	MatchingSHA512 uint8 = 2
+)
+
+var (
+	// ErrNoUsableTLSA is returned when there are no Secure TLSA records the
+	// verifier can use.
+	ErrNoUsableTLSA = errors.New("no usable TLSA records")
+	// ErrNoMatch is returned when no usable TLSA record matches the
+	// certificate chain of the server.
+	ErrNoMatch = errors.New("no TLSA record matches the server certificate chain")
+)
+
+// VerifyOptions configure Verify.
+type VerifyOptions struct {
+	// Names are the reference identifiers the server certificate must
+	// carry for all usages except DANE-EE, see [rfc7671] 5.1.
+	Names []string
+	// Roots are the trust anchors of PKIX-TA and PKIX-EE records. Nil uses
+	// the system roots.
+	Roots *x509.CertPool
+	// NoPKIX makes PKIX-TA and PKIX-EE records unusable, like for SMTP, see
+	// [rfc7672] 3.1.3.
+	NoPKIX bool
+	// CurrentTime is used instead of the current time if not zero.
+	CurrentTime time.Time
+}
+
+// Usable reports whether tlsa has a certificate usage, selector and matching
+// type the verifier supports.
+func Usable(tlsa *dns.TLSA, noPKIX bool) bool {
+	switch tlsa.Usage {
+	case UsagePKIXTA, UsagePKIXEE:
+		if noPKIX {
+			return false
+		}
+	case UsageDANETA, UsageDANEEE:
+	default:
+		return false
+	}
+	if tlsa.Selector != SelectorCert && tlsa.Selector != SelectorSPKI {
+		return false
+	}
+	switch tlsa.MatchingType {
+	case MatchingFull, MatchingSHA256, MatchingSHA512:
+		return true
+	}
+	return false
+}
+
+// Match reports whether the certificate association data of tlsa matches
+// cert, ignoring the certificate usage.
+func Match(tlsa *dns.TLSA, cert *x509.Certificate) bool {
+	var data []byte
+	switch tlsa.Selector {
+	case SelectorCert:
+		data = cert.Raw
+	case SelectorSPKI:
+		data = cert.RawSubjectPublicKeyInfo
+	default:
+		return false
+	}
+	switch tlsa.MatchingType {
+	case MatchingFull:
+	case MatchingSHA256:
+		sum := sha256.Sum256(data)
+		data = sum[:]
+	case MatchingSHA512:
+		sum := sha512.Sum512(data)
+		data = sum[:]
+	default:
+		return false
+	}
+	association, err := hex.DecodeString(tlsa.Certificate)
+	return err == nil && bytes.Equal(association, data)
+}
+
+// Verify authenticates the server of state with the Secure records. It
+// succeeds if one usable record matches, see [rfc7671] 5, and returns
+// ErrNoUsableTLSA if there is none.
+func Verify(state tls.ConnectionState, records []*dns.TLSA, opts VerifyOptions) (err error) {
+	if len(state.PeerCertificates) == 0 {
+		err = fmt.Errorf("server presented no certificate")
+		return
+	}
+	leaf := state.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	usable := false
+	err = ErrNoMatch
+	for _, tlsa := range records {
+		if !Usable(tlsa, opts.NoPKIX) {
+			continue
+		}
+		usable = true
+		switch tlsa.Usage {
+		case UsageDANEEE:
+			// [rfc7671] 5.1. neither names nor validity periods are checked
+			if Match(tlsa, leaf) {
+				err = nil
+				return
+			}
+		case UsageDANETA:
+			// [rfc7671] 5.2. the trust anchor has to be in the chain the
+			// server presents, which is then verified like with PKIX
+			for _, ta := range state.PeerCertificates[1:] {
+				if !Match(tlsa, ta) {
+					continue
+				}
+				roots := x509.NewCertPool()
+				roots.AddCert(ta)
+				_, verifyErr := verifyChain(leaf, roots, intermediates, opts)
+				if verifyErr == nil {
+					err = nil
+					return
+				}
+				err = fmt.Errorf("%w: DANE-TA: %v", ErrNoMatch, verifyErr)
+			}
+		case UsagePKIXTA, UsagePKIXEE:
+			chains, verifyErr := verifyChain(leaf, opts.Roots, intermediates, opts)
+			if verifyErr != nil {
+				err = fmt.Errorf("%w: PKIX: %v", ErrNoMatch, verifyErr)
+				continue
+			}
+			if tlsa.Usage == UsagePKIXEE {
+				if Match(tlsa, leaf) {
+					err = nil
+					return
+				}
+				continue
+			}
+			for _, chain := range chains {
+				for _, cert := range chain[1:] {
+					if Match(tlsa, cert) {
+						err = nil
+						return
+					}
+				}
+			}
+		}
+	}
+	if !usable {
+		err = ErrNoUsableTLSA
+	}
+	return
+}
+
+// VerifyPKIX authenticates the server of state with PKIX alone for one of the
+// names of opts.
+func VerifyPKIX(state tls.ConnectionState, opts VerifyOptions) (err error) {
+	if len(state.PeerCertificates) == 0 {
+		err = fmt.Errorf("server presented no certificate")
+		return
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = verifyChain(state.PeerCertificates[0], opts.Roots, intermediates, opts)
+	return
+}
+
+// verifyChain verifies leaf up to roots for the first of the names of opts it
+// is valid for.
+func verifyChain(leaf *x509.Certificate, roots, intermediates *x509.CertPool, opts VerifyOptions) (chains [][]*x509.Certificate, err error) {
+	if len(opts.Names) == 0 {
+		err = fmt.Errorf("no reference identifier to check the certificate name against")
+		return
+	}
+	for _, name := range opts.Names {
+		chains, err = leaf.Verify(x509.VerifyOptions{
+			DNSName:       strings.TrimSuffix(name, "."),
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   opts.CurrentTime,
+		})
+		if err == nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,39 @@
+package dane
+
+import (
+	"crypto/x509"
+)
+
+// Policy decides how to verify a server without Secure usable TLSA records.
+type Policy int
+
+const (
+	// PolicyPKIXFallback verifies the server with PKIX alone, which is how
+	// clients not supporting DANE verify it, see [rfc7671] 4.1.
+	PolicyPKIXFallback Policy = iota
+	// PolicyRequireDANE fails the connection.
+	PolicyRequireDANE
+)
+
+type config struct {
+	policy Policy
+	roots  *x509.CertPool
+}
+
+type Option func(*config)
+
+// WithPolicy sets how to verify servers without Secure usable TLSA records.
+// The default is PolicyPKIXFallback.
+func WithPolicy(policy Policy) Option {
+	return func(c *config) {
+		c.policy = policy
+	}
+}
+
+// WithRootCAs sets the trust anchors for PKIX verification, which are the
+// system roots by default.
+func WithRootCAs(roots *x509.CertPool) Option {
+	return func(c *config) {
+		c.roots = roots
+	}
+}
@@ -0,0 +1,162 @@
+package dane
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+)
+
+// SMTPSecurity is the TLS security level for delivering mail to an MX host,
+// see [rfc7672] 2.2.
+type SMTPSecurity int
+
+const (
+	// SMTPOpportunistic uses TLS if the server offers it without
+	// authenticating it and falls back to cleartext otherwise.
+	SMTPOpportunistic SMTPSecurity = iota
+	// SMTPEncrypt requires TLS without authenticating the server, because
+	// its Secure TLSA records are all unusable, see [rfc7672] 2.2.
+	SMTPEncrypt
+	// SMTPDANE requires TLS authenticated with the TLSA records.
+	SMTPDANE
+)
+
+func (security SMTPSecurity) String() string {
+	switch security {
+	case SMTPOpportunistic:
+		return "opportunistic"
+	case SMTPEncrypt:
+		return "encrypt"
+	case SMTPDANE:
+		return "dane"
+	}
+	return fmt.Sprintf("SMTPSecurity(%d)", int(security))
+}
+
+// ErrNullMX is returned for domains announcing that they accept no mail,
+// see [rfc7505].
+var ErrNullMX = errors.New("domain does not accept mail")
+
+// SMTPPolicy is how mail for a domain has to be delivered.
+type SMTPPolicy struct {
+	// Domain is the next-hop domain of the mail.
+	Domain string
+	// Status is the security status of the MX RRset.
+	Status dnssec.SecurityStatus
+	// Hosts are the MX hosts ordered by preference.
+	Hosts []*SMTPHost
+}
+
+// SMTPHost is the security level of one MX host of an SMTPPolicy.
+type SMTPHost struct {
+	Name       string
+	Preference uint16
+	Domain     string
+	Security   SMTPSecurity
+	TLSA       TLSARecords
+	// Err is set when the host must not be used, e.g. because its address
+	// or TLSA records are Bogus, see [rfc7672] 2.1.1.
+	Err error
+}
+
+// SMTPPolicy looks up the MX hosts of domain and their TLSA records on port
+// 25. Without MX records domain itself is the MX host ([rfc5321] 5.1). Bogus
+// or Indeterminate MX records return an error, so delivery is deferred.
+func (verifier *Verifier) SMTPPolicy(domain string) (policy *SMTPPolicy, err error) {
+	fqdn := dns.Fqdn(domain)
+	msg, err := verifier.resolver.Resolve(fqdn, dns.TypeMX)
+	if err != nil && !errors.Is(err, dnssec.ErrInsecure) {
+		err = fmt.Errorf("failed to look up MX records of %s: %w", fqdn, err)
+		return
+	}
+	policy = &SMTPPolicy{Domain: fqdn, Status: err}
+	err = nil
+	if msg.Rcode != dns.RcodeSuccess {
+		err = fmt.Errorf("failed to look up MX records of %s: %s", fqdn, dns.RcodeToString[msg.Rcode])
+		policy = nil
+		return
+	}
+	for _, rr := range msg.Answer {
+		if mx, ok := rr.(*dns.MX); ok {
+			policy.Hosts = append(policy.Hosts, &SMTPHost{Name: mx.Mx, Preference: mx.Preference, Domain: fqdn})
+		}
+	}
+	if len(policy.Hosts) == 0 {
+		policy.Hosts = []*SMTPHost{{Name: fqdn, Domain: fqdn}}
+	}
+	if len(policy.Hosts) == 1 && policy.Hosts[0].Name == "." {
+		err = fmt.Errorf("%w: %s", ErrNullMX, fqdn)
+		policy = nil
+		return
+	}
+	sort.SliceStable(policy.Hosts, func(i, j int) bool {
+		return policy.Hosts[i].Preference < policy.Hosts[j].Preference
+	})
+
+	// [rfc7672] 2.2.1. DANE does not apply to the hosts of an insecure MX
+	// RRset, an attacker could have chosen them
+	if policy.Status != dnssec.Secure {
+		return
+	}
+	for _, host := range policy.Hosts {
+		verifier.smtpHost(host)
+	}
+	return
+}
+
+func (verifier *Verifier) smtpHost(host *SMTPHost) {
+	// [rfc7672] 2.2.2. TLSA records are only looked up for hosts with
+	// Secure address records
+	_, status, err := verifier.resolver.LookupIP("ip", host.Name)
+	if host.Err = dnssec.IgnoreNotFound(err); host.Err != nil || status != dnssec.Secure {
+		return
+	}
+	if host.TLSA, host.Err = verifier.LookupTLSA(25, "tcp", host.Name); host.Err != nil || host.TLSA.Status != dnssec.Secure || len(host.TLSA.Records) == 0 {
+		return
+	}
+	host.Security = SMTPEncrypt
+	for _, tlsa := range host.TLSA.Records {
+		if Usable(tlsa, true) {
+			host.Security = SMTPDANE
+			break
+		}
+	}
+}
+
+// Verify authenticates the server of state as required by the security level
+// of host. DANE-TA records accept the TLSA base domain, the MX host name and
+// the next-hop domain as names of the certificate, see [rfc7672] 3.2.3, while
+// PKIX-TA and PKIX-EE records are not used, see [rfc7672] 3.1.3.
+func (host *SMTPHost) Verify(state tls.ConnectionState) error {
+	if host.Err != nil {
+		return host.Err
+	}
+	if host.Security != SMTPDANE {
+		return nil
+	}
+	names := append(append([]string(nil), host.TLSA.Names...), host.Domain)
+	return Verify(state, host.TLSA.Records, VerifyOptions{Names: names, NoPKIX: true})
+}
+
+// TLSConfig returns a clone of config for crypto/tls or the StartTLS method of
+// a net/smtp client talking to host, which verifies the server as required by
+// its security level. The server name is the TLSA base domain, see [rfc7672]
+// 8.1.
+func (host *SMTPHost) TLSConfig(config *tls.Config) *tls.Config {
+	if config == nil {
+		config = new(tls.Config)
+	}
+	config = config.Clone()
+	config.ServerName = strings.TrimSuffix(host.Name, ".")
+	if len(host.TLSA.Names) > 0 {
+		config.ServerName = strings.TrimSuffix(host.TLSA.Names[0], ".")
+	}
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = host.Verify
+	return config
+}
@@ -0,0 +1,108 @@
+package dane_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/dnssec/dane"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestSMTPPolicy(t *testing.T) {
+	ca := newTestCert(t, "Test CA", nil)
+	domainCert := newTestCert(t, "example", ca)
+	selfSigned := newTestCert(t, "mx1.example", nil)
+
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add(
+		"example. 300 IN MX 20 mx2.example.",
+		"example. 300 IN MX 10 mx1.example.",
+		"example. 300 IN MX 30 mx3.example.",
+		"example. 300 IN MX 40 mx.broken.",
+		"example. 300 IN MX 50 mx.unsigned.",
+		"example. 300 IN MX 60 mx5.example.",
+		"mx1 300 IN A 192.0.2.1",
+		"mx2 300 IN A 192.0.2.2",
+		"mx3 300 IN A 192.0.2.3",
+		"mx5 300 IN A 192.0.2.5",
+		tlsaRR("_25._tcp.mx1", dane.UsageDANEEE, dane.SelectorSPKI, dane.MatchingSHA256, selfSigned.cert),
+		tlsaRR("_25._tcp.mx2", dane.UsagePKIXEE, dane.SelectorCert, dane.MatchingSHA256, selfSigned.cert),
+		tlsaRR("_25._tcp.mx5", dane.UsageDANETA, dane.SelectorCert, dane.MatchingSHA256, ca.cert),
+		"null 300 IN MX 0 .",
+		"nomx 300 IN A 192.0.2.6",
+	)
+	tree.AddZone("broken.").Add("mx 300 IN A 192.0.2.7").Bogus = true
+	tree.AddZone("unsigned.").Add(
+		"unsigned. 300 IN MX 10 mx1.example.",
+		"mx 300 IN A 192.0.2.8",
+	).Unsigned = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := dane.New(resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := verifier.SMTPPolicy("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Status != dnssec.Secure || len(policy.Hosts) != 6 {
+		t.Fatalf("expected secure MX RRset with 6 hosts, got %v %v", policy.Status, policy.Hosts)
+	}
+	for i, want := range []struct {
+		name     string
+		security dane.SMTPSecurity
+		err      error
+	}{
+		{"mx1.example.", dane.SMTPDANE, nil},
+		{"mx2.example.", dane.SMTPEncrypt, nil},
+		{"mx3.example.", dane.SMTPOpportunistic, nil},
+		{"mx.broken.", dane.SMTPOpportunistic, dnssec.ErrBogus},
+		{"mx.unsigned.", dane.SMTPOpportunistic, nil},
+		{"mx5.example.", dane.SMTPDANE, nil},
+	} {
+		host := policy.Hosts[i]
+		if host.Name != want.name || host.Security != want.security || !errors.Is(host.Err, want.err) || (want.err == nil) != (host.Err == nil) {
+			t.Errorf("%d: expected %s with %v and %v, got %s with %v and %v", i, want.name, want.security, want.err, host.Name, host.Security, host.Err)
+		}
+	}
+
+	selfChain := tls.ConnectionState{PeerCertificates: []*x509.Certificate{selfSigned.cert}}
+	domainChain := tls.ConnectionState{PeerCertificates: []*x509.Certificate{domainCert.cert, ca.cert}}
+	if err = policy.Hosts[0].Verify(selfChain); err != nil {
+		t.Errorf("expected DANE-EE host to verify, got %v", err)
+	}
+	if err = policy.Hosts[0].Verify(domainChain); !errors.Is(err, dane.ErrNoMatch) {
+		t.Errorf("expected DANE-EE host to reject other certificate, got %v", err)
+	}
+	// DANE-TA accepts a certificate for the next-hop domain
+	if err = policy.Hosts[5].Verify(domainChain); err != nil {
+		t.Errorf("expected DANE-TA host to verify certificate for next-hop domain, got %v", err)
+	}
+	if config := policy.Hosts[5].TLSConfig(nil); config.ServerName != "mx5.example" || config.VerifyConnection == nil {
+		t.Errorf("unexpected TLS config %v", config)
+	}
+	if err = policy.Hosts[2].Verify(selfChain); err != nil {
+		t.Errorf("expected opportunistic host to accept any certificate, got %v", err)
+	}
+
+	// hosts of an insecure MX RRset get no DANE
+	if policy, err = verifier.SMTPPolicy("unsigned."); err != nil || len(policy.Hosts) != 1 || policy.Hosts[0].Security != dane.SMTPOpportunistic {
+		t.Errorf("expected opportunistic TLS for insecure MX RRset, got %v %v", policy, err)
+	}
+	if policy, err = verifier.SMTPPolicy("nomx.example."); err != nil || len(policy.Hosts) != 1 || policy.Hosts[0].Name != "nomx.example." {
+		t.Errorf("expected implicit MX, got %v %v", policy, err)
+	}
+	if _, err = verifier.SMTPPolicy("null.example."); !errors.Is(err, dane.ErrNullMX) {
+		t.Errorf("expected ErrNullMX, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package dane_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/dnssec/dane"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+	} else {
+		template.DNSNames = []string{name}
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func tlsaRR(owner string, usage, selector, matching uint8, cert *x509.Certificate) string {
+	data := cert.Raw
+	if selector == dane.SelectorSPKI {
+		data = cert.RawSubjectPublicKeyInfo
+	}
+	switch matching {
+	case dane.MatchingSHA256:
+		sum := sha256.Sum256(data)
+		data = sum[:]
+	case dane.MatchingSHA512:
+		sum := sha512.Sum512(data)
+		data = sum[:]
+	}
+	return fmt.Sprintf("%s 300 IN TLSA %d %d %d %s", owner, usage, selector, matching, hex.EncodeToString(data))
+}
+
+func TestVerifier(t *testing.T) {
+	ca := newTestCert(t, "Test CA", nil)
+	leaf := newTestCert(t, "www.example", ca)
+	selfSigned := newTestCert(t, "self.example", nil)
+	other := newTestCert(t, "other.example", nil)
+	unsignedLeaf := newTestCert(t, "www.unsigned", ca)
+
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add(
+		"www 300 IN A 192.0.2.1",
+		"self 300 IN A 192.0.2.2",
+		"alias 300 IN CNAME self.example.",
+		"ta 300 IN A 192.0.2.3",
+		"wrong 300 IN A 192.0.2.4",
+		"unusable 300 IN A 192.0.2.5",
+		tlsaRR("_443._tcp.self", dane.UsageDANEEE, dane.SelectorSPKI, dane.MatchingSHA256, selfSigned.cert),
+		tlsaRR("_443._tcp.www", dane.UsageDANETA, dane.SelectorCert, dane.MatchingSHA512, ca.cert),
+		tlsaRR("_443._tcp.wrong", dane.UsageDANEEE, dane.SelectorCert, dane.MatchingFull, other.cert),
+		"_443._tcp.unusable 300 IN TLSA 3 1 255 00",
+	)
+	tree.AddZone("unsigned.").Add(
+		"www 300 IN A 192.0.2.6",
+		tlsaRR("_443._tcp.www", dane.UsageDANEEE, dane.SelectorSPKI, dane.MatchingSHA256, selfSigned.cert),
+	).Unsigned = true
+	tree.AddZone("broken.").Add(
+		"www 300 IN A 192.0.2.7",
+		tlsaRR("_443._tcp.www", dane.UsageDANEEE, dane.SelectorSPKI, dane.MatchingSHA256, leaf.cert),
+	).Bogus = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	fallback, err := dane.New(resolver, dane.WithRootCAs(roots))
+	if err != nil {
+		t.Fatal(err)
+	}
+	required, err := dane.New(resolver, dane.WithPolicy(dane.PolicyRequireDANE), dane.WithRootCAs(roots))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafChain := tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf.cert, ca.cert}}
+	selfChain := tls.ConnectionState{PeerCertificates: []*x509.Certificate{selfSigned.cert}}
+	unsignedChain := tls.ConnectionState{PeerCertificates: []*x509.Certificate{unsignedLeaf.cert, ca.cert}}
+	for _, tc := range []struct {
+		host     string
+		state    tls.ConnectionState
+		verifier *dane.Verifier
+		err      error
+	}{
+		{"self.example.", selfChain, required, nil},
+		{"alias.example.", selfChain, required, nil},
+		{"www.example.", leafChain, required, nil},
+		{"wrong.example.", selfChain, fallback, dane.ErrNoMatch},
+		{"unusable.example.", leafChain, required, dane.ErrNoUsableTLSA},
+		{"ta.example.", leafChain, required, dane.ErrNoUsableTLSA},
+		// PKIX fallback for names without Secure TLSA records
+		{"www.unsigned.", unsignedChain, fallback, nil},
+		{"www.unsigned.", unsignedChain, required, dane.ErrNoUsableTLSA},
+		{"www.broken.", leafChain, fallback, dnssec.ErrBogus},
+	} {
+		err := tc.verifier.Verify(tc.state, 443, "tcp", tc.host)
+		switch tc.err {
+		case nil:
+			if err != nil {
+				t.Errorf("%s: expected verification to succeed, got %v", tc.host, err)
+			}
+		default:
+			if !errors.Is(err, tc.err) {
+				t.Errorf("%s: expected %v, got %v", tc.host, tc.err, err)
+			}
+		}
+	}
+	// PKIX fallback for a publicly trusted name without TLSA records
+	if err = fallback.Verify(leafChain, 443, "tcp", "ta.example."); err == nil {
+		t.Error("expected PKIX fallback to check the name of the certificate")
+	}
+
+	// the hook for crypto/tls in a full handshake
+	serverConfig := &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{selfSigned.cert.Raw},
+		PrivateKey:  selfSigned.key,
+	}}}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	server := tls.Server(serverConn, serverConfig)
+	go server.Handshake()
+	client := tls.Client(clientConn, required.TLSConfig(&tls.Config{ServerName: "self.example"}, 443))
+	if err = client.Handshake(); err != nil {
+		t.Errorf("expected handshake with DANE-EE server to succeed, got %v", err)
+	}
+}
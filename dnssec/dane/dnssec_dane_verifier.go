@@ -0,0 +1,128 @@
+package dane
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+)
+
+// Verifier authenticates TLS servers with the TLSA records of their names,
+// looked up through a validating dnssec.Resolver.
+type Verifier struct {
+	config
+	resolver *dnssec.Resolver
+}
+
+func New(resolver *dnssec.Resolver, options ...Option) (verifier *Verifier, err error) {
+	verifier = &Verifier{resolver: resolver}
+	for _, opt := range options {
+		opt(&verifier.config)
+	}
+	if resolver == nil {
+		err = fmt.Errorf("no DNSSEC resolver provided for creating DANE verifier")
+		return
+	}
+	return
+}
+
+// TLSARecords are the TLSA records of a TLS server together with the names
+// its certificate may carry.
+type TLSARecords struct {
+	// Records are the TLSA records found, usable or not.
+	Records []*dns.TLSA
+	// Status is the security status of the records, Secure or wrapping
+	// dnssec.ErrInsecure.
+	Status dnssec.SecurityStatus
+	// Names are the host name and, if it is a Secure alias, the name at the
+	// end of its CNAME chain, see [rfc7671] 7.
+	Names []string
+}
+
+// LookupTLSA looks up the TLSA records of host at _port._proto.host. If host
+// is an alias in a Secure CNAME chain the TLSA records of its target are
+// preferred, see [rfc7671] 7. No records at all are not an error. Bogus and
+// Indeterminate answers are.
+func (verifier *Verifier) LookupTLSA(port uint16, proto, host string) (tlsa TLSARecords, err error) {
+	fqdn := dns.Fqdn(host)
+	tlsa.Names = []string{fqdn}
+	cname, status, err := verifier.resolver.LookupCNAME(fqdn)
+	if err = dnssec.IgnoreNotFound(err); err != nil {
+		return
+	}
+	bases := []string{fqdn}
+	if status == dnssec.Secure && !strings.EqualFold(cname, fqdn) {
+		tlsa.Names = append([]string{cname}, fqdn)
+		bases = tlsa.Names
+	}
+	for _, base := range bases {
+		name := "_" + strconv.Itoa(int(port)) + "._" + proto + "." + base
+		var rrs []dns.RR
+		rrs, tlsa.Status, err = verifier.resolver.LookupRRs(name, dns.TypeTLSA)
+		if err = dnssec.IgnoreNotFound(err); err != nil {
+			return
+		}
+		for _, rr := range rrs {
+			tlsa.Records = append(tlsa.Records, rr.(*dns.TLSA))
+		}
+		if len(tlsa.Records) > 0 {
+			return
+		}
+	}
+	return
+}
+
+// Verify authenticates the server of state reached at port and proto of
+// host. Secure usable TLSA records have to match, without them the
+// configured Policy applies. Bogus TLSA records always fail, see [rfc6698]
+// 4.1.
+func (verifier *Verifier) Verify(state tls.ConnectionState, port uint16, proto, host string) (err error) {
+	tlsa, err := verifier.LookupTLSA(port, proto, host)
+	if err != nil {
+		err = fmt.Errorf("failed to look up TLSA records of %s: %w", host, err)
+		return
+	}
+	opts := VerifyOptions{Names: tlsa.Names, Roots: verifier.roots}
+	if tlsa.Status == dnssec.Secure {
+		if err = Verify(state, tlsa.Records, opts); !errors.Is(err, ErrNoUsableTLSA) {
+			return
+		}
+	}
+	if verifier.policy == PolicyRequireDANE {
+		err = fmt.Errorf("%w for %s", ErrNoUsableTLSA, host)
+		return
+	}
+	// only the original name is a reference identifier for PKIX
+	opts.Names = []string{dns.Fqdn(host)}
+	err = VerifyPKIX(state, opts)
+	return
+}
+
+// VerifyConnection returns a function for tls.Config.VerifyConnection
+// verifying the server named by the SNI of the connection on port and proto.
+func (verifier *Verifier) VerifyConnection(port uint16, proto string) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if state.ServerName == "" {
+			return fmt.Errorf("no server name to look up TLSA records for")
+		}
+		return verifier.Verify(state, port, proto, state.ServerName)
+	}
+}
+
+// TLSConfig returns a clone of config verifying servers on TCP port with
+// DANE. The default verification of crypto/tls is disabled, because it would
+// reject DANE-TA and DANE-EE servers without a publicly trusted certificate,
+// and done by Verify instead.
+func (verifier *Verifier) TLSConfig(config *tls.Config, port uint16) *tls.Config {
+	if config == nil {
+		config = new(tls.Config)
+	}
+	config = config.Clone()
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = verifier.VerifyConnection(port, "tcp")
+	return config
+}
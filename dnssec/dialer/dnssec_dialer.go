@@ -0,0 +1,310 @@
+// Package dialer connects to hosts by name with Happy Eyeballs version 2 as
+// described in [rfc8305], resolving their addresses through a validating
+// dnssec.Resolver instead of the system resolver.
+package dialer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/dnssec/svcb"
+)
+
+// Dialer races connections to the IPv6 and IPv4 addresses of a host. Its
+// DialContext method fits net/http.Transport.DialContext.
+type Dialer struct {
+	config
+	resolver *dnssec.Resolver
+	planner  *svcb.Planner
+}
+
+func New(resolver *dnssec.Resolver, options ...Option) (dialer *Dialer, err error) {
+	dialer = &Dialer{resolver: resolver}
+	dialer.resolutionDelay = DefaultResolutionDelay
+	dialer.connectionAttemptDelay = DefaultConnectionAttemptDelay
+	dialer.dial = new(net.Dialer).DialContext
+	for _, opt := range options {
+		opt(&dialer.config)
+	}
+	if resolver == nil {
+		err = fmt.Errorf("no DNSSEC resolver provided for creating dialer")
+		return
+	}
+	dialer.planner, err = svcb.New(resolver, svcb.WithoutAddressLookup(), svcb.WithoutOriginFallback())
+	return
+}
+
+const (
+	ipv6 = iota
+	ipv4
+	hints
+)
+
+// answer holds the addresses of one lookup for the family ipv6 or ipv4, or
+// the address hints of the HTTPS records for hints.
+type answer struct {
+	family int
+	ips    []net.IP
+	err    error
+}
+
+type target struct {
+	ip   net.IP
+	hint bool
+}
+
+type result struct {
+	conn net.Conn
+	err  error
+}
+
+// Dial connects to address on network "tcp", "tcp4" or "tcp6".
+func (dialer *Dialer) Dial(network, address string) (net.Conn, error) {
+	return dialer.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to address on network "tcp", "tcp4" or "tcp6". The
+// AAAA and A RRs of the host are looked up concurrently, together with the
+// address hints of its HTTPS records, which are replaced by the addresses
+// once they arrive, see [rfc9460] 7.3. Connection attempts alternate between
+// the address families, starting with IPv6, and a new attempt starts every
+// connection attempt delay or as soon as the previous one fails. A Bogus
+// answer arriving before a connection is established fails the dial.
+func (dialer *Dialer) DialContext(ctx context.Context, network, address string) (conn net.Conn, err error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return
+	}
+	var requested [2]bool
+	switch network {
+	case "tcp":
+		requested = [2]bool{true, true}
+	case "tcp4":
+		requested[ipv4] = true
+	case "tcp6":
+		requested[ipv6] = true
+	default:
+		err = net.UnknownNetworkError(network)
+		return
+	}
+	if net.ParseIP(host) != nil {
+		return dialer.dial(ctx, network, address)
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		err = fmt.Errorf("invalid port in %s: %w", address, err)
+		return
+	}
+
+	answers := make(chan answer, 3)
+	lookups := 0
+	for family, ok := range requested {
+		if ok {
+			go dialer.lookup(host, family, answers)
+			lookups++
+		}
+	}
+	if !dialer.noHTTPSHints {
+		go dialer.lookupHints(host, uint16(port), answers)
+		lookups++
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan result)
+	var (
+		queues            [2][]target
+		waiting           = requested
+		resolved          [2]bool
+		next              = ipv6
+		attempts          int
+		attempted         = make(map[string]bool)
+		started           bool
+		resolutionElapsed bool
+		resolutionTimer   <-chan time.Time
+		attemptTimer      <-chan time.Time
+		attemptReady      = true
+		lookupErr         error
+		dialErr           error
+	)
+	for {
+		// [rfc8305] 3. wait a little for AAAA RRs once A RRs arrived
+		ready := started || len(queues[ipv6]) > 0 || !waiting[ipv6] || resolutionElapsed
+		if ready && attemptReady {
+			if t, ok := pop(&queues, &next); ok {
+				started, attemptReady = true, false
+				attempts++
+				attempted[t.ip.String()] = true
+				go func(address string) {
+					c, err := dialer.dial(ctx, network, address)
+					results <- result{c, err}
+				}(net.JoinHostPort(t.ip.String(), portString))
+				attemptTimer = time.After(dialer.connectionAttemptDelay)
+			}
+		}
+		if attempts == 0 && lookups == 0 && len(queues[ipv6]) == 0 && len(queues[ipv4]) == 0 {
+			break
+		}
+
+		select {
+		case a := <-answers:
+			lookups--
+			if a.family == hints {
+				for _, ip := range a.ips {
+					family := familyOf(ip)
+					if requested[family] && !resolved[family] && !attempted[ip.String()] {
+						queues[family] = append(queues[family], target{ip: ip, hint: true})
+					}
+				}
+				continue
+			}
+			waiting[a.family] = false
+			if a.family == ipv4 && waiting[ipv6] && !started {
+				resolutionTimer = time.After(dialer.resolutionDelay)
+			}
+			if a.err != nil {
+				if errors.Is(a.err, dnssec.ErrBogus) || errors.Is(a.err, dnssec.ErrIndeterminate) {
+					go closeLate(results, attempts)
+					err = fmt.Errorf("failed to look up addresses of %s: %w", host, a.err)
+					return
+				}
+				if lookupErr == nil || dnssec.IgnoreNotFound(a.err) != nil {
+					lookupErr = a.err
+				}
+				continue
+			}
+			if len(a.ips) > 0 {
+				resolved[a.family] = true
+				queues[a.family] = dropHints(queues[a.family])
+			}
+			for _, ip := range a.ips {
+				if !attempted[ip.String()] {
+					queues[a.family] = append(queues[a.family], target{ip: ip})
+				}
+			}
+		case <-resolutionTimer:
+			resolutionElapsed, resolutionTimer = true, nil
+		case <-attemptTimer:
+			attemptReady, attemptTimer = true, nil
+		case r := <-results:
+			attempts--
+			if r.err == nil {
+				go closeLate(results, attempts)
+				conn = r.conn
+				return
+			}
+			// [rfc8305] 5. a failed attempt does not wait for the delay
+			dialErr, attemptReady = r.err, true
+		case <-ctx.Done():
+			go closeLate(results, attempts)
+			err = ctx.Err()
+			return
+		}
+	}
+
+	switch {
+	case dialErr != nil:
+		err = dialErr
+	case lookupErr != nil:
+		err = lookupErr
+	default:
+		err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	err = fmt.Errorf("failed to dial %s: %w", address, err)
+	return
+}
+
+// lookup sends the addresses of host for family to answers, which are only
+// usable if Secure when the dialer requires it.
+func (dialer *Dialer) lookup(host string, family int, answers chan<- answer) {
+	qtype := dns.TypeAAAA
+	if family == ipv4 {
+		qtype = dns.TypeA
+	}
+	a := answer{family: family}
+	rrs, status, err := dialer.resolver.LookupRRs(host, qtype)
+	switch {
+	case err != nil:
+		a.err = err
+	case status != dnssec.Secure && dialer.requireSecure:
+		a.err = fmt.Errorf("%s RRs of %s: %w", dns.TypeToString[qtype], host, status)
+	}
+	if a.err == nil {
+		for _, rr := range rrs {
+			switch rr := rr.(type) {
+			case *dns.A:
+				a.ips = append(a.ips, rr.A)
+			case *dns.AAAA:
+				a.ips = append(a.ips, rr.AAAA)
+			}
+		}
+	}
+	answers <- a
+}
+
+// lookupHints sends the address hints of the HTTPS records of host to
+// answers. Only endpoints at host and port can be dialed in its place, and
+// the hints are merely an optimization, so failures are ignored.
+func (dialer *Dialer) lookupHints(host string, port uint16, answers chan<- answer) {
+	a := answer{family: hints}
+	candidates, err := dialer.planner.PlanHTTPS(host, port)
+	fqdn := dns.CanonicalName(host)
+	for _, candidate := range candidates {
+		if err != nil || candidate.Port != port || dns.CanonicalName(candidate.Target) != fqdn {
+			continue
+		}
+		if dialer.requireSecure && candidate.Status != dnssec.Secure {
+			continue
+		}
+		a.ips = append(a.ips, candidate.IPs...)
+	}
+	answers <- a
+}
+
+// pop returns the next address to try, alternating between the address
+// families starting at next, see [rfc8305] 4.
+func pop(queues *[2][]target, next *int) (t target, ok bool) {
+	family := *next
+	if len(queues[family]) == 0 {
+		family = 1 - family
+	}
+	if len(queues[family]) == 0 {
+		return
+	}
+	t, queues[family] = queues[family][0], queues[family][1:]
+	*next = 1 - family
+	ok = true
+	return
+}
+
+func dropHints(queue []target) (kept []target) {
+	for _, t := range queue {
+		if !t.hint {
+			kept = append(kept, t)
+		}
+	}
+	return
+}
+
+func familyOf(ip net.IP) int {
+	if ip.To4() != nil {
+		return ipv4
+	}
+	return ipv6
+}
+
+// closeLate closes the connections of the attempts still running once the
+// dial returned.
+func closeLate(results <-chan result, attempts int) {
+	for ; attempts > 0; attempts-- {
+		if r := <-results; r.conn != nil {
+			r.conn.Close()
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package dialer
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+const (
+	// DefaultResolutionDelay is how long to wait for AAAA RRs after the A
+	// RRs arrived, see [rfc8305] 3.
+	DefaultResolutionDelay = 50 * time.Millisecond
+	// DefaultConnectionAttemptDelay is how long to wait for a connection
+	// attempt before starting the next one, see [rfc8305] 5.
+	DefaultConnectionAttemptDelay = 250 * time.Millisecond
+)
+
+type config struct {
+	requireSecure          bool
+	noHTTPSHints           bool
+	resolutionDelay        time.Duration
+	connectionAttemptDelay time.Duration
+	dial                   func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+type Option func(*config)
+
+// WithRequireSecure makes the dialer refuse addresses from Insecure answers.
+// Bogus answers are always refused.
+func WithRequireSecure() Option {
+	return func(c *config) {
+		c.requireSecure = true
+	}
+}
+
+// WithoutHTTPSHints makes the dialer ignore the ipv4hint and ipv6hint
+// parameters of the HTTPS records of the host dialed.
+func WithoutHTTPSHints() Option {
+	return func(c *config) {
+		c.noHTTPSHints = true
+	}
+}
+
+// WithResolutionDelay sets how long to wait for AAAA RRs after the A RRs
+// arrived. The default is DefaultResolutionDelay.
+func WithResolutionDelay(delay time.Duration) Option {
+	return func(c *config) {
+		c.resolutionDelay = delay
+	}
+}
+
+// WithConnectionAttemptDelay sets how long to wait for a connection attempt
+// before racing the next address against it. The default is
+// DefaultConnectionAttemptDelay.
+func WithConnectionAttemptDelay(delay time.Duration) Option {
+	return func(c *config) {
+		c.connectionAttemptDelay = delay
+	}
+}
+
+// WithDialContext sets the function connecting to a single address, by
+// default the DialContext method of a zero net.Dialer.
+func WithDialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) Option {
+	return func(c *config) {
+		c.dial = dial
+	}
+}
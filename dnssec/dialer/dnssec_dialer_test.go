@@ -0,0 +1,114 @@
+package dialer_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/dnssec/dialer"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+// fakeNetwork accepts connections to the addresses up and never completes
+// those to the others.
+type fakeNetwork struct {
+	mutex    sync.Mutex
+	up       map[string]bool
+	attempts []string
+}
+
+func (n *fakeNetwork) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	n.mutex.Lock()
+	n.attempts = append(n.attempts, address)
+	up := n.up[address]
+	n.mutex.Unlock()
+	if !up {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+func (n *fakeNetwork) Attempts() []string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return append([]string(nil), n.attempts...)
+}
+
+func TestDialContext(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add(
+		"www 300 IN AAAA 2001:db8::1",
+		"www 300 IN AAAA 2001:db8::2",
+		"www 300 IN A 192.0.2.1",
+		"hinted 300 IN HTTPS 1 . ipv4hint=192.0.2.2",
+	)
+	tree.AddZone("unsigned.").Add("www 300 IN A 192.0.2.3").Unsigned = true
+	tree.AddZone("broken.").Add("www 300 IN A 192.0.2.4").Bogus = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	network := &fakeNetwork{up: map[string]bool{
+		"192.0.2.1:443": true,
+		"192.0.2.2:443": true,
+		"192.0.2.3:443": true,
+		"192.0.2.4:443": true,
+	}}
+	d, err := dialer.New(resolver,
+		dialer.WithDialContext(network.DialContext),
+		dialer.WithConnectionAttemptDelay(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := d.DialContext(context.Background(), "tcp", "www.example.:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if attempts := network.Attempts(); len(attempts) != 2 || attempts[0] != "[2001:db8::1]:443" || attempts[1] != "192.0.2.1:443" {
+		t.Errorf("expected IPv6 attempt raced by IPv4, got %v", attempts)
+	}
+
+	if conn, err = d.Dial("tcp", "hinted.example:443"); err != nil {
+		t.Errorf("expected connection to HTTPS address hint, got %v", err)
+	} else {
+		conn.Close()
+	}
+	if conn, err = d.Dial("tcp", "www.unsigned.:443"); err != nil {
+		t.Errorf("expected Insecure address to be acceptable, got %v", err)
+	} else {
+		conn.Close()
+	}
+	if _, err = d.Dial("tcp", "www.broken.:443"); !errors.Is(err, dnssec.ErrBogus) {
+		t.Errorf("expected Bogus address to fail, got %v", err)
+	}
+
+	secure, err := dialer.New(resolver, dialer.WithDialContext(network.DialContext), dialer.WithRequireSecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = secure.Dial("tcp", "www.unsigned.:443"); !errors.Is(err, dnssec.ErrInsecure) {
+		t.Errorf("expected Insecure address to fail, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = secure.DialContext(ctx, "tcp6", "www.example.:443"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected unreachable IPv6 addresses to time out, got %v", err)
+	}
+
+	// the dialer plugs into http.Transport
+	_ = &http.Transport{DialContext: d.DialContext}
+}
@@ -0,0 +1,150 @@
+// Package dnssd discovers services with DNS-Based Service Discovery over
+// unicast DNS as described in [rfc6763], validating every answer through a
+// dnssec.Resolver.
+package dnssd
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+)
+
+// Domain enumeration queries, see [rfc6763] 11.
+const (
+	DomainsBrowse          = "b"
+	DomainsDefaultBrowse   = "db"
+	DomainsRegister        = "r"
+	DomainsDefaultRegister = "dr"
+	DomainsLegacyBrowse    = "lb"
+)
+
+// Browser browses and resolves service instances through a validating
+// dnssec.Resolver.
+type Browser struct {
+	resolver *dnssec.Resolver
+}
+
+func New(resolver *dnssec.Resolver) (browser *Browser, err error) {
+	browser = &Browser{resolver: resolver}
+	if resolver == nil {
+		err = fmt.Errorf("no DNSSEC resolver provided for creating DNS-SD browser")
+		return
+	}
+	return
+}
+
+// Instance is the name of a service instance <Instance>.<Service>.<Domain>,
+// see [rfc6763] 4.1.
+type Instance struct {
+	// Name is the full name in presentation format.
+	Name string
+	// Instance is the unescaped user-visible name.
+	Instance string
+	// Service is the service type, e.g. "_ipp._tcp".
+	Service string
+	Domain  string
+}
+
+// ParseInstance splits the service instance name name.
+func ParseInstance(name string) (instance Instance, err error) {
+	instance.Name = dns.Fqdn(name)
+	labels := dns.SplitDomainName(instance.Name)
+	if len(labels) < 4 || !strings.HasPrefix(labels[1], "_") || !strings.HasPrefix(labels[2], "_") {
+		err = fmt.Errorf("invalid service instance name %s", name)
+		return
+	}
+	instance.Instance = string(unescape(labels[0]))
+	instance.Service = labels[1] + "." + labels[2]
+	instance.Domain = dns.Fqdn(strings.Join(labels[3:], "."))
+	return
+}
+
+// Service is a resolved service instance.
+type Service struct {
+	Instance
+	// SRVs are the endpoints of the instance, ordered by priority and
+	// weight.
+	SRVs       []*net.SRV
+	Attributes Attributes
+	// Status is Secure only if the SRV and TXT records are.
+	Status dnssec.SecurityStatus
+}
+
+// Browse returns the instances of service, e.g. "_ipp._tcp", in domain from
+// the PTR records at <Service>.<Domain>, see [rfc6763] 4.1. subtype selects
+// the instances of a subtype if not empty, see [rfc6763] 7.1.
+func (browser *Browser) Browse(service, subtype, domain string) (instances []Instance, status dnssec.SecurityStatus, err error) {
+	name := service + "." + dns.Fqdn(domain)
+	if subtype != "" {
+		name = subtype + "._sub." + name
+	}
+	names, status, err := browser.lookupPTR(name)
+	for _, name := range names {
+		instance, parseErr := ParseInstance(name)
+		if parseErr == nil {
+			instances = append(instances, instance)
+		}
+	}
+	return
+}
+
+// BrowseServiceTypes returns the service types advertised in domain, e.g.
+// "_ipp._tcp.example.", see [rfc6763] 9.
+func (browser *Browser) BrowseServiceTypes(domain string) (services []string, status dnssec.SecurityStatus, err error) {
+	return browser.lookupPTR("_services._dns-sd._udp." + dns.Fqdn(domain))
+}
+
+// EnumerateDomains returns the domains recommended by domain for the query
+// kind, one of the Domains constants, see [rfc6763] 11.
+func (browser *Browser) EnumerateDomains(kind, domain string) (domains []string, status dnssec.SecurityStatus, err error) {
+	switch kind {
+	case DomainsBrowse, DomainsDefaultBrowse, DomainsRegister, DomainsDefaultRegister, DomainsLegacyBrowse:
+	default:
+		err = fmt.Errorf("unknown domain enumeration query %q", kind)
+		return
+	}
+	return browser.lookupPTR(kind + "._dns-sd._udp." + dns.Fqdn(domain))
+}
+
+// lookupPTR returns the names the PTR records at name point to, none without
+// an error if there are none.
+func (browser *Browser) lookupPTR(name string) (names []string, status dnssec.SecurityStatus, err error) {
+	rrs, status, err := browser.resolver.LookupRRs(name, dns.TypePTR)
+	if err = dnssec.IgnoreNotFound(err); err != nil {
+		return
+	}
+	for _, rr := range rrs {
+		names = append(names, rr.(*dns.PTR).Ptr)
+	}
+	return
+}
+
+// Resolve returns the endpoints and attributes of the service instance
+// name, see [rfc6763] 6. An instance without a TXT record has no attributes.
+func (browser *Browser) Resolve(name string) (service Service, err error) {
+	if service.Instance, err = ParseInstance(name); err != nil {
+		return
+	}
+	_, service.SRVs, service.Status, err = browser.resolver.LookupSRV("", "", service.Name)
+	if err != nil {
+		err = fmt.Errorf("failed to look up SRV records of %s: %w", service.Name, err)
+		return
+	}
+	rrs, status, err := browser.resolver.LookupRRs(service.Name, dns.TypeTXT)
+	if err = dnssec.IgnoreNotFound(err); err != nil {
+		err = fmt.Errorf("failed to look up TXT records of %s: %w", service.Name, err)
+		return
+	}
+	if status != dnssec.Secure {
+		service.Status = status
+	}
+	service.Attributes = make(Attributes)
+	if len(rrs) > 0 {
+		// [rfc6763] 6. an instance has a single TXT record
+		service.Attributes = ParseTXT(rrs[0].(*dns.TXT).Txt)
+	}
+	return
+}
@@ -0,0 +1,83 @@
+package dnssd_test
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/dnssec/dnssd"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestParseTXT(t *testing.T) {
+	attrs := dnssd.ParseTXT([]string{"txtvers=1", "", "=ignored", "PaperSize=A4", "papersize=Letter", "color", "note=", `path=/a\"b\255`})
+	if attrs.Get("txtvers") != "1" || attrs.Get("papersize") != "A4" {
+		t.Errorf("unexpected attributes %q", attrs)
+	}
+	if !attrs.Has("color") || attrs["color"] != nil || attrs["note"] == nil || len(attrs["note"]) != 0 {
+		t.Errorf("expected boolean and empty attributes, got %q", attrs)
+	}
+	if attrs.Get("path") != "/a\"b\xff" || len(attrs) != 5 {
+		t.Errorf("unexpected attributes %q", attrs)
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add(
+		`b._dns-sd._udp 300 IN PTR example.`,
+		`b._dns-sd._udp 300 IN PTR office.example.`,
+		`_services._dns-sd._udp 300 IN PTR _ipp._tcp.example.`,
+		`_ipp._tcp 300 IN PTR Printer\032Two._ipp._tcp.example.`,
+		`_ipp._tcp 300 IN PTR Printer\032One._ipp._tcp.example.`,
+		`_color._sub._ipp._tcp 300 IN PTR Printer\032One._ipp._tcp.example.`,
+		`Printer\032One._ipp._tcp 300 IN SRV 0 0 631 printer1.example.`,
+		`Printer\032One._ipp._tcp 300 IN TXT "txtvers=1" "Color=T"`,
+		`Printer\032Two._ipp._tcp 300 IN SRV 0 0 631 printer2.example.`,
+	)
+	tree.AddZone("broken.").Add(`_ipp._tcp 300 IN PTR Printer._ipp._tcp.broken.`).Bogus = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	browser, err := dnssd.New(resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	domains, status, err := browser.EnumerateDomains(dnssd.DomainsBrowse, "example.")
+	if err != nil || status != dnssec.Secure || len(domains) != 2 {
+		t.Errorf("expected browsing domains, got %v %v %v", domains, status, err)
+	}
+	services, status, err := browser.BrowseServiceTypes("example.")
+	if err != nil || status != dnssec.Secure || len(services) != 1 || services[0] != "_ipp._tcp.example." {
+		t.Errorf("expected service types, got %v %v %v", services, status, err)
+	}
+	instances, status, err := browser.Browse("_ipp._tcp", "", "example.")
+	if err != nil || status != dnssec.Secure || len(instances) != 2 {
+		t.Fatalf("expected instances, got %v %v %v", instances, status, err)
+	}
+	if instances, _, err = browser.Browse("_ipp._tcp", "_color", "example."); err != nil || len(instances) != 1 || instances[0].Instance != "Printer One" {
+		t.Fatalf("expected instance of subtype, got %v %v", instances, err)
+	}
+	if instances, _, err = browser.Browse("_http._tcp", "", "example."); err != nil || len(instances) != 0 {
+		t.Errorf("expected no instances, got %v %v", instances, err)
+	}
+
+	service, err := browser.Resolve(`Printer\032One._ipp._tcp.example.`)
+	if err != nil || service.Status != dnssec.Secure || len(service.SRVs) != 1 || service.SRVs[0].Port != 631 {
+		t.Fatalf("expected Secure SRV records, got %+v %v", service, err)
+	}
+	if service.Service != "_ipp._tcp" || service.Domain != "example." || service.Attributes.Get("color") != "T" {
+		t.Errorf("unexpected service %+v", service)
+	}
+	if service, err = browser.Resolve(`Printer\032Two._ipp._tcp.example.`); err != nil || len(service.Attributes) != 0 {
+		t.Errorf("expected service without attributes, got %+v %v", service, err)
+	}
+	if _, _, err = browser.Browse("_ipp._tcp", "", "broken."); !errors.Is(err, dnssec.ErrBogus) {
+		t.Errorf("expected Bogus instances to fail, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package dnssd
+
+import (
+	"strings"
+)
+
+// Attributes are the key/value pairs of the TXT record of a service instance,
+// see [rfc6763] 6.3. Keys are lowercase. A nil value is a boolean attribute
+// present without "=", an empty value one with "=" but no value.
+type Attributes map[string][]byte
+
+// Has reports whether the attribute key is present, see [rfc6763] 6.4.
+func (attrs Attributes) Has(key string) bool {
+	_, ok := attrs[strings.ToLower(key)]
+	return ok
+}
+
+// Get returns the value of the attribute key as a string.
+func (attrs Attributes) Get(key string) string {
+	return string(attrs[strings.ToLower(key)])
+}
+
+// ParseTXT parses the character strings of a TXT record, as presented by
+// miekg/dns, into attributes. Empty strings and strings without a key are
+// ignored, and only the first occurrence of a key counts, see [rfc6763] 6.4.
+func ParseTXT(txt []string) (attrs Attributes) {
+	attrs = make(Attributes)
+	for _, s := range txt {
+		data := unescape(s)
+		key, value := data, []byte(nil)
+		if eq := strings.IndexByte(string(data), '='); eq >= 0 {
+			key, value = data[:eq], append([]byte{}, data[eq+1:]...)
+		}
+		if len(key) == 0 {
+			continue
+		}
+		k := strings.ToLower(string(key))
+		if _, ok := attrs[k]; !ok {
+			attrs[k] = value
+		}
+	}
+	return
+}
+
+// unescape decodes the \X and \DDD escapes of the presentation format.
+func unescape(s string) (data []byte) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			if i+3 < len(s) && digit(s[i+1]) && digit(s[i+2]) && digit(s[i+3]) {
+				c = (s[i+1]-'0')*100 + (s[i+2]-'0')*10 + (s[i+3] - '0')
+				i += 3
+			} else {
+				i++
+				c = s[i]
+			}
+		}
+		data = append(data, c)
+	}
+	return
+}
+
+func digit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
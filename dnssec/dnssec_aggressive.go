@@ -0,0 +1,614 @@
+package dnssec
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// [rfc8198] Aggressive Use of DNSSEC-Validated Cache
+//
+// NSEC and NSEC3 RRs prove that no names or no types exist in whole ranges of
+// a zone. Once validated, they answer queries for other names in the same
+// ranges without asking upstream, which also blunts random subdomain attacks
+// against the upstream resolvers.
+
+// nsec3OptOut is the Opt-Out flag of NSEC3 RRs, see [rfc5155] 3.1.2.1.
+const nsec3OptOut = 1
+
+// aggressivePruneInterval is how often add drops the expired RRsets of all
+// zones, not only of the zone it adds to.
+const aggressivePruneInterval = time.Minute
+
+type aggressiveCache struct {
+	mutex     sync.RWMutex
+	zones     map[string]*aggressiveZone
+	limits    Limits
+	lastPrune time.Time
+}
+
+// aggressiveZone holds the validated RRsets of a zone needed to synthesize
+// answers: its SOA, its NSEC RRs in canonical order, its NSEC3 RRs in the
+// order of their hashed owner names and the wildcard RRsets answers were
+// expanded from, by owner name and type.
+type aggressiveZone struct {
+	soa       *signedRRset
+	nsec      []*signedRRset
+	nsec3     []*signedRRset
+	wildcards map[wildcardKey]*signedRRset
+}
+
+type wildcardKey struct {
+	name string
+	typ  uint16
+}
+
+// signedRRset is an RRset together with the RRSIG RR it was validated with.
+type signedRRset struct {
+	rrs     []dns.RR
+	rrsig   *dns.RRSIG
+	expires time.Time
+}
+
+func newAggressiveCache(limits Limits) *aggressiveCache {
+	return &aggressiveCache{zones: make(map[string]*aggressiveZone), limits: limits}
+}
+
+// add keeps the RRsets of msg needed for synthesizing answers which are
+// signed by zone and validate with its keys.
+func (c *aggressiveCache) add(msg *dns.Msg, zone string, keys KeySet) {
+	if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+		return
+	}
+	now := time.Now()
+	denials := validatedRRsets(msg.Ns, zone, keys, c.limits, now)
+	var expansions []*signedRRset
+	for _, rr := range msg.Answer {
+		if rrsig, ok := rr.(*dns.RRSIG); ok && int(rrsig.Labels) < dns.CountLabel(rrsig.Hdr.Name) {
+			// only answers expanded from a wildcard are worth keeping
+			expansions = validatedRRsets(msg.Answer, zone, keys, c.limits, now)
+			break
+		}
+	}
+	if len(denials) == 0 && len(expansions) == 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if now.Sub(c.lastPrune) >= aggressivePruneInterval {
+		c.lastPrune = now
+		for name, z := range c.zones {
+			if z.prune(now); z.soa == nil && z.len() == 0 {
+				delete(c.zones, name)
+			}
+		}
+	}
+	z := c.zones[zone]
+	if z == nil {
+		z = &aggressiveZone{wildcards: make(map[wildcardKey]*signedRRset)}
+		c.zones[zone] = z
+	} else {
+		z.prune(now)
+	}
+	var negativeTTL time.Time
+	for _, set := range denials {
+		if soa, ok := set.rrs[0].(*dns.SOA); ok {
+			z.soa = set
+			// [rfc9077] 3. NSEC and NSEC3 RRs may not be used longer than
+			// a negative answer may be cached
+			ttl := soa.Minttl
+			if soa.Hdr.Ttl < ttl {
+				ttl = soa.Hdr.Ttl
+			}
+			negativeTTL = now.Add(time.Duration(ttl) * time.Second)
+		}
+	}
+	for _, set := range denials {
+		if !negativeTTL.IsZero() && negativeTTL.Before(set.expires) {
+			set.expires = negativeTTL
+		}
+		switch rr := set.rrs[0].(type) {
+		case *dns.NSEC:
+			z.nsec = nsecOrder.insert(z.nsec, set)
+		case *dns.NSEC3:
+			if len(z.nsec3) > 0 && !sameNSEC3Params(z.nsec3[0].rrs[0].(*dns.NSEC3), rr) {
+				// the zone changed its hash parameters, the NSEC3 RRs
+				// hashed with the old ones are no longer of use
+				z.nsec3 = nil
+			}
+			z.nsec3 = nsec3Order.insert(z.nsec3, set)
+		}
+	}
+	for _, set := range expansions {
+		owner := set.rrs[0].Header().Name
+		labels := dns.SplitDomainName(owner)
+		if int(set.rrsig.Labels) >= len(labels) {
+			continue
+		}
+		wildcard := dns.CanonicalName(strings.Join(append([]string{"*"}, labels[len(labels)-int(set.rrsig.Labels):]...), "."))
+		z.wildcards[wildcardKey{wildcard, set.rrsig.TypeCovered}] = set
+	}
+	for z.len() > 0 && z.len() > c.limits.MaxAggressiveRRsets {
+		z.evict()
+	}
+}
+
+func (z *aggressiveZone) len() int {
+	return len(z.nsec) + len(z.nsec3) + len(z.wildcards)
+}
+
+// prune drops the RRsets of z which expired at now.
+func (z *aggressiveZone) prune(now time.Time) {
+	if live(z.soa, now) == nil {
+		z.soa = nil
+	}
+	z.nsec, z.nsec3 = pruneSorted(z.nsec, now), pruneSorted(z.nsec3, now)
+	for key, set := range z.wildcards {
+		if live(set, now) == nil {
+			delete(z.wildcards, key)
+		}
+	}
+}
+
+// evict drops the RRset of z which expires first.
+func (z *aggressiveZone) evict() {
+	var first *signedRRset
+	for _, sets := range [][]*signedRRset{z.nsec, z.nsec3} {
+		for _, set := range sets {
+			if first == nil || set.expires.Before(first.expires) {
+				first = set
+			}
+		}
+	}
+	var firstKey *wildcardKey
+	for key, set := range z.wildcards {
+		if first == nil || set.expires.Before(first.expires) {
+			key := key
+			first, firstKey = set, &key
+		}
+	}
+	if firstKey != nil {
+		delete(z.wildcards, *firstKey)
+		return
+	}
+	z.nsec, z.nsec3 = removeSet(z.nsec, first), removeSet(z.nsec3, first)
+}
+
+// setOrder sorts the NSEC or NSEC3 RRsets of a zone by a key taken from their
+// owner name.
+type setOrder struct {
+	key     func(*signedRRset) string
+	compare func(a, b string) int
+}
+
+// nsecOrder is the canonical order of owner names, see [rfc4034] 6.1.
+var nsecOrder = setOrder{
+	key:     func(set *signedRRset) string { return dns.CanonicalName(set.rrs[0].Header().Name) },
+	compare: canonicalCompare,
+}
+
+// nsec3Order is the order of hashed owner names, which is the one of their
+// base32hex encoding, see [rfc5155] 3.
+var nsec3Order = setOrder{
+	key: func(set *signedRRset) string {
+		return strings.ToUpper(dns.SplitDomainName(set.rrs[0].Header().Name)[0])
+	},
+	compare: strings.Compare,
+}
+
+// search returns the index of the first RRset of sets whose key is not less
+// than key.
+func (o setOrder) search(sets []*signedRRset, key string) int {
+	return sort.Search(len(sets), func(i int) bool {
+		return o.compare(o.key(sets[i]), key) >= 0
+	})
+}
+
+// insert adds set to sets, replacing the RRset with the same owner name.
+func (o setOrder) insert(sets []*signedRRset, set *signedRRset) []*signedRRset {
+	key := o.key(set)
+	i := o.search(sets, key)
+	if i < len(sets) && o.compare(o.key(sets[i]), key) == 0 {
+		sets[i] = set
+		return sets
+	}
+	sets = append(sets, nil)
+	copy(sets[i+1:], sets[i:])
+	sets[i] = set
+	return sets
+}
+
+// pruneSorted drops the RRsets of sets which expired at now, keeping the
+// order of the others.
+func pruneSorted(sets []*signedRRset, now time.Time) []*signedRRset {
+	kept := sets[:0]
+	for _, set := range sets {
+		if live(set, now) != nil {
+			kept = append(kept, set)
+		}
+	}
+	for i := len(kept); i < len(sets); i++ {
+		sets[i] = nil
+	}
+	return kept
+}
+
+func removeSet(sets []*signedRRset, set *signedRRset) []*signedRRset {
+	for i := range sets {
+		if sets[i] == set {
+			copy(sets[i:], sets[i+1:])
+			sets[len(sets)-1] = nil
+			return sets[:len(sets)-1]
+		}
+	}
+	return sets
+}
+
+func sameNSEC3Params(a, b *dns.NSEC3) bool {
+	return a.Hash == b.Hash && a.Iterations == b.Iterations && strings.EqualFold(a.Salt, b.Salt)
+}
+
+// lookup synthesizes an NXDOMAIN, NODATA or wildcard answer for qname and
+// qtype from the validated RRsets of the closest enclosing zone, if they
+// prove it.
+func (c *aggressiveCache) lookup(qname string, qtype uint16) (msg *dns.Msg, ok bool) {
+	qname = dns.CanonicalName(qname)
+	now := time.Now()
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	zone := qname
+	if qtype == dns.TypeDS && zone != "." {
+		// the DS RRset belongs to the parent side of a zone cut
+		zone = getParentFQDN(zone)
+	}
+	z := c.zones[zone]
+	for z == nil && zone != "." {
+		zone = getParentFQDN(zone)
+		z = c.zones[zone]
+	}
+	if z == nil || z.soa == nil || !now.Before(z.soa.expires) {
+		return
+	}
+	msg = new(dns.Msg)
+	msg.SetQuestion(qname, qtype)
+	msg.Response = true
+	msg.RecursionAvailable = true
+	msg.SetEdns0(4096, true)
+	if !z.synthesizeNSEC(msg, qname, qtype, now) && !z.synthesizeNSEC3(msg, zone, qname, qtype, now) {
+		msg = nil
+		return
+	}
+	ok = true
+	return
+}
+
+func (z *aggressiveZone) synthesizeNSEC(msg *dns.Msg, qname string, qtype uint16, now time.Time) bool {
+	if match := z.matchNSEC(qname, now); match != nil {
+		if !deniesType(match.rrs[0].(*dns.NSEC).TypeBitMap, qtype) {
+			return false
+		}
+		z.negative(msg, dns.RcodeSuccess, now, match)
+		return true
+	}
+
+	covering := z.coveringNSEC(qname, now)
+	if covering == nil {
+		return false
+	}
+	nsec := covering.rrs[0].(*dns.NSEC)
+	n := dns.CompareDomainName(qname, nsec.Hdr.Name)
+	if m := dns.CompareDomainName(qname, nsec.NextDomain); m > n {
+		n = m
+	}
+	labels := dns.SplitDomainName(qname)
+	closestEncloser := dns.Fqdn(strings.Join(labels[len(labels)-n:], "."))
+	wildcard := "*." + closestEncloser
+	if closestEncloser == "." {
+		wildcard = "*."
+	}
+
+	if answered, exists := z.wildcard(msg, wildcard, qname, qtype, now, z.matchNSEC(wildcard, now), covering); exists {
+		return answered
+	}
+	wildcardCovering := z.coveringNSEC(wildcard, now)
+	if wildcardCovering == nil {
+		return false
+	}
+	z.negative(msg, dns.RcodeNameError, now, covering, wildcardCovering)
+	return true
+}
+
+func (z *aggressiveZone) synthesizeNSEC3(msg *dns.Msg, zone, qname string, qtype uint16, now time.Time) bool {
+	if len(z.nsec3) == 0 {
+		return false
+	}
+	if match := z.matchNSEC3(qname, now); match != nil {
+		if !deniesType(match.rrs[0].(*dns.NSEC3).TypeBitMap, qtype) {
+			return false
+		}
+		z.negative(msg, dns.RcodeSuccess, now, match)
+		return true
+	}
+
+	// [rfc5155] 8.4. closest encloser proof
+	for ce := getParentFQDN(qname); dns.IsSubDomain(zone, ce); ce = getParentFQDN(ce) {
+		closestEncloser := z.matchNSEC3(ce, now)
+		if closestEncloser == nil {
+			if ce == zone {
+				return false
+			}
+			continue
+		}
+		if cutBelow(closestEncloser.rrs[0].(*dns.NSEC3).TypeBitMap) {
+			// [rfc5155] 8.3. and [rfc6672] 5.3.4.1. names below a delegation
+			// or a DNAME are not denied by the NSEC3 RRs of this zone
+			return false
+		}
+		nextCloser := z.coverNSEC3(nextCloserName(ce, qname), now)
+		if nextCloser == nil || nextCloser.rrs[0].(*dns.NSEC3).Flags&nsec3OptOut != 0 {
+			// [rfc8198] 4.5. Opt-Out NSEC3 RRs cannot prove that a name
+			// does not exist
+			return false
+		}
+		wildcard := "*." + ce
+		if ce == "." {
+			wildcard = "*."
+		}
+		if answered, exists := z.wildcard(msg, wildcard, qname, qtype, now, z.matchNSEC3(wildcard, now), closestEncloser, nextCloser); exists {
+			return answered
+		}
+		wildcardCovering := z.coverNSEC3(wildcard, now)
+		if wildcardCovering == nil {
+			return false
+		}
+		z.negative(msg, dns.RcodeNameError, now, closestEncloser, nextCloser, wildcardCovering)
+		return true
+	}
+	return false
+}
+
+// wildcard answers qname from the cached RRset of wildcard, or with NODATA if
+// match, the NSEC or NSEC3 RR of the wildcard, denies qtype. exists is false
+// when neither proves that the wildcard exists.
+func (z *aggressiveZone) wildcard(msg *dns.Msg, wildcard, qname string, qtype uint16, now time.Time, match *signedRRset, proofs ...*signedRRset) (answered, exists bool) {
+	if set := live(z.wildcards[wildcardKey{wildcard, qtype}], now); set != nil {
+		set.appendTo(&msg.Answer, qname, now)
+		for _, proof := range proofs {
+			proof.appendTo(&msg.Ns, "", now)
+		}
+		answered, exists = true, true
+		return
+	}
+	if match == nil {
+		return
+	}
+	exists = true
+	var bitmap []uint16
+	switch denial := match.rrs[0].(type) {
+	case *dns.NSEC:
+		bitmap = denial.TypeBitMap
+	case *dns.NSEC3:
+		bitmap = denial.TypeBitMap
+	}
+	if deniesType(bitmap, qtype) {
+		z.negative(msg, dns.RcodeSuccess, now, append(proofs, match)...)
+		answered = true
+	}
+	return
+}
+
+func (z *aggressiveZone) negative(msg *dns.Msg, rcode int, now time.Time, proofs ...*signedRRset) {
+	msg.Rcode = rcode
+	z.soa.appendTo(&msg.Ns, "", now)
+	seen := make(map[*signedRRset]bool)
+	for _, proof := range proofs {
+		if !seen[proof] {
+			seen[proof] = true
+			proof.appendTo(&msg.Ns, "", now)
+		}
+	}
+}
+
+func (z *aggressiveZone) matchNSEC(name string, now time.Time) *signedRRset {
+	if i := nsecOrder.search(z.nsec, name); i < len(z.nsec) && canonicalCompare(nsecOrder.key(z.nsec[i]), name) == 0 {
+		return live(z.nsec[i], now)
+	}
+	return nil
+}
+
+// coveringNSEC returns the NSEC RR proving that name does not exist, which
+// can only be the one with the closest owner name before it.
+func (z *aggressiveZone) coveringNSEC(name string, now time.Time) *signedRRset {
+	i := nsecOrder.search(z.nsec, name)
+	if i == 0 {
+		return nil
+	}
+	if set := live(z.nsec[i-1], now); set != nil && nsecCovers(set.rrs[0].(*dns.NSEC), name) {
+		return set
+	}
+	return nil
+}
+
+// hashName hashes name with the parameters of the NSEC3 RRs of z.
+func (z *aggressiveZone) hashName(name string) string {
+	nsec3 := z.nsec3[0].rrs[0].(*dns.NSEC3)
+	return dns.HashName(name, nsec3.Hash, nsec3.Iterations, nsec3.Salt)
+}
+
+func (z *aggressiveZone) matchNSEC3(name string, now time.Time) *signedRRset {
+	if len(z.nsec3) == 0 {
+		return nil
+	}
+	hash := z.hashName(name)
+	if i := nsec3Order.search(z.nsec3, hash); i < len(z.nsec3) && nsec3Order.key(z.nsec3[i]) == hash {
+		return live(z.nsec3[i], now)
+	}
+	return nil
+}
+
+// coverNSEC3 returns the NSEC3 RR whose hashed owner name is the closest one
+// before the hash of name, or the last one when the hash of name sorts
+// before all of them, if it covers name.
+func (z *aggressiveZone) coverNSEC3(name string, now time.Time) *signedRRset {
+	if len(z.nsec3) == 0 {
+		return nil
+	}
+	hash := z.hashName(name)
+	i := nsec3Order.search(z.nsec3, hash)
+	if i < len(z.nsec3) && nsec3Order.key(z.nsec3[i]) == hash {
+		return nil
+	}
+	if i == 0 {
+		i = len(z.nsec3)
+	}
+	if set := live(z.nsec3[i-1], now); set != nil && set.rrs[0].(*dns.NSEC3).Cover(name) {
+		return set
+	}
+	return nil
+}
+
+func live(set *signedRRset, now time.Time) *signedRRset {
+	if set == nil || !now.Before(set.expires) {
+		return nil
+	}
+	return set
+}
+
+// appendTo appends the RRset and its RRSIG RR to section with their TTL
+// reduced to the time left, renaming them to owner if it is not empty.
+func (set *signedRRset) appendTo(section *[]dns.RR, owner string, now time.Time) {
+	ttl := uint32(set.expires.Sub(now) / time.Second)
+	for _, rr := range append(append([]dns.RR(nil), set.rrs...), set.rrsig) {
+		rr = dns.Copy(rr)
+		if owner != "" {
+			rr.Header().Name = owner
+		}
+		if rr.Header().Ttl > ttl {
+			rr.Header().Ttl = ttl
+		}
+		*section = append(*section, rr)
+	}
+}
+
+// deniesType reports whether an NSEC or NSEC3 type bitmap proves that there
+// is no RRset of qtype, nor a CNAME or a delegation that would answer it
+// instead.
+func deniesType(bitmap []uint16, qtype uint16) bool {
+	if hasType(bitmap, qtype) || hasType(bitmap, dns.TypeCNAME) {
+		return false
+	}
+	if qtype != dns.TypeDS && hasType(bitmap, dns.TypeNS) && !hasType(bitmap, dns.TypeSOA) {
+		// [rfc4035] 5.4. the NSEC RR of a delegation only speaks for the
+		// parent side of the zone cut
+		return false
+	}
+	return true
+}
+
+// cutBelow reports whether an NSEC or NSEC3 type bitmap belongs to a
+// delegation or a DNAME, so that the names below its owner are not part of
+// the zone.
+func cutBelow(bitmap []uint16) bool {
+	return hasType(bitmap, dns.TypeDNAME) || (hasType(bitmap, dns.TypeNS) && !hasType(bitmap, dns.TypeSOA))
+}
+
+// nsecCovers reports whether name falls between the owner name and the next
+// domain name of nsec, so that it does not exist. Names below a delegation
+// or a DNAME are not covered.
+func nsecCovers(nsec *dns.NSEC, name string) bool {
+	owner, next := dns.CanonicalName(nsec.Hdr.Name), dns.CanonicalName(nsec.NextDomain)
+	if cutBelow(nsec.TypeBitMap) && dns.IsSubDomain(owner, name) {
+		return false
+	}
+	if canonicalCompare(owner, name) >= 0 {
+		return false
+	}
+	// the last NSEC RR of a zone points back to its apex
+	return canonicalCompare(name, next) < 0 || canonicalCompare(next, owner) <= 0
+}
+
+// canonicalCompare orders names as described in [rfc4034] 6.1.
+func canonicalCompare(a, b string) int {
+	la, lb := dns.SplitDomainName(strings.ToLower(a)), dns.SplitDomainName(strings.ToLower(b))
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(unescapeLabel(la[i]), unescapeLabel(lb[j])); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+// unescapeLabel turns the presentation format of a label into its octets.
+func unescapeLabel(label string) string {
+	if !strings.Contains(label, `\`) {
+		return label
+	}
+	var b strings.Builder
+	for i := 0; i < len(label); i++ {
+		if label[i] != '\\' || i+1 >= len(label) {
+			b.WriteByte(label[i])
+			continue
+		}
+		i++
+		if i+2 < len(label) && isDigit(label[i]) && isDigit(label[i+1]) && isDigit(label[i+2]) {
+			b.WriteByte((label[i]-'0')*100 + (label[i+1]-'0')*10 + (label[i+2] - '0'))
+			i += 2
+		} else {
+			b.WriteByte(label[i])
+		}
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// nextCloserName returns the name one label longer than closestEncloser on
+// the way to name, see [rfc5155] 1.3.
+func nextCloserName(closestEncloser, name string) string {
+	labels := dns.SplitDomainName(name)
+	n := dns.CountLabel(closestEncloser) + 1
+	if n > len(labels) {
+		return name
+	}
+	return dns.Fqdn(strings.Join(labels[len(labels)-n:], "."))
+}
+
+func matchNSEC3(rrs []dns.RR, name string) *dns.NSEC3 {
+	for _, rr := range rrs {
+		if nsec3, ok := rr.(*dns.NSEC3); ok && nsec3.Match(name) {
+			return nsec3
+		}
+	}
+	return nil
+}
+
+func coverNSEC3(rrs []dns.RR, name string) *dns.NSEC3 {
+	for _, rr := range rrs {
+		if nsec3, ok := rr.(*dns.NSEC3); ok && !nsec3.Match(name) && nsec3.Cover(name) {
+			return nsec3
+		}
+	}
+	return nil
+}
+
+// validatedRRsets returns the RRsets of section signed by zone with an RRSIG
+// RR that validates with one of keys.
+func validatedRRsets(section []dns.RR, zone string, keys KeySet, limits Limits, now time.Time) (sets []*signedRRset) {
+	for _, result := range verifyRRsets(section, zone, keys, limits) {
+		if result.Status != Secure {
+			continue
+		}
+		sets = append(sets, &signedRRset{
+			rrs:     result.RRset.RRs,
+			rrsig:   result.RRSIG,
+			expires: rrsetValidity(now, result.RRset.Append(nil, result.RRSIG)).NotAfter,
+		})
+	}
+	return
+}
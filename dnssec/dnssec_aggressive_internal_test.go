@@ -0,0 +1,138 @@
+package dnssec
+
+import (
+	"crypto"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testSigner returns a key of zone and a function signing RRsets with it.
+func testSigner(t *testing.T, zone string) (key *dns.DNSKEY, sign func(rrs ...dns.RR) []dns.RR) {
+	key = &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE,
+		Protocol:  3,
+		Algorithm: dns.ED25519,
+	}
+	private, err := key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign = func(rrs ...dns.RR) []dns.RR {
+		rrsig := &dns.RRSIG{
+			Hdr:        dns.RR_Header{Name: rrs[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: rrs[0].Header().Ttl},
+			Algorithm:  key.Algorithm,
+			KeyTag:     key.KeyTag(),
+			SignerName: key.Hdr.Name,
+			Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+			Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+		}
+		if err := rrsig.Sign(private.(crypto.Signer), rrs); err != nil {
+			t.Fatal(err)
+		}
+		return append(rrs, rrsig)
+	}
+	return
+}
+
+func TestAggressiveNSEC3Cut(t *testing.T) {
+	key, sign := testSigner(t, "hashed.")
+	soa, err := dns.NewRR("hashed. 300 IN SOA ns.hashed. hostmaster.hashed. 1 3600 600 86400 300")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := dns.HashName("child.hashed.", dns.SHA1, 0, "")
+
+	for _, tc := range []struct {
+		bitmap      []uint16
+		synthesized bool
+	}{
+		{[]uint16{dns.TypeA, dns.TypeRRSIG}, true},
+		{[]uint16{dns.TypeNS}, false},
+		{[]uint16{dns.TypeNS, dns.TypeDS, dns.TypeRRSIG}, false},
+		{[]uint16{dns.TypeDNAME, dns.TypeRRSIG}, false},
+	} {
+		// a single NSEC3 RR whose next hashed owner name is its own covers
+		// every other name of the zone
+		nsec3 := &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: hash + ".hashed.", Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+			Hash:       dns.SHA1,
+			HashLength: 20,
+			NextDomain: hash,
+			TypeBitMap: tc.bitmap,
+		}
+		msg := new(dns.Msg)
+		msg.SetQuestion("a.child.hashed.", dns.TypeA)
+		msg.Rcode = dns.RcodeNameError
+		msg.Ns = append(sign(soa), sign(nsec3)...)
+
+		cache := newAggressiveCache(DefaultLimits)
+		cache.add(msg, "hashed.", NewKeySet(key))
+		answer, ok := cache.lookup("b.child.hashed.", dns.TypeA)
+		if ok != tc.synthesized {
+			t.Errorf("%v: expected synthesized %v, got %v", tc.bitmap, tc.synthesized, answer)
+		}
+	}
+}
+
+func TestAggressiveCacheBounds(t *testing.T) {
+	key, sign := testSigner(t, "example.")
+	limits := DefaultLimits
+	limits.MaxAggressiveRRsets = 3
+	cache := newAggressiveCache(limits)
+	add := func(owner, next string, ttl uint32) {
+		msg := new(dns.Msg)
+		msg.SetQuestion(owner, dns.TypeTXT)
+		msg.Ns = sign(&dns.NSEC{
+			Hdr:        dns.RR_Header{Name: owner, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: ttl},
+			NextDomain: next,
+			TypeBitMap: []uint16{dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC},
+		})
+		cache.add(msg, "example.", NewKeySet(key))
+	}
+	owners := func() (names []string) {
+		for _, set := range cache.zones["example."].nsec {
+			names = append(names, set.rrs[0].Header().Name)
+		}
+		return
+	}
+
+	// the RRsets expiring first are dropped beyond the limit
+	add("d.example.", "e.example.", 400)
+	add("a.example.", "b.example.", 600)
+	add("c.example.", "d.example.", 100)
+	add("b.example.", "c.example.", 500)
+	add("e.example.", "example.", 300)
+	if got := fmt.Sprint(owners()); got != "[a.example. b.example. d.example.]" {
+		t.Errorf("expected the longest lived NSEC RRs in canonical order, got %s", got)
+	}
+
+	// expired RRsets are dropped when adding
+	cache.zones["example."].nsec[0].expires = time.Now().Add(-time.Second)
+	add("f.example.", "example.", 700)
+	if got := fmt.Sprint(owners()); got != "[b.example. d.example. f.example.]" {
+		t.Errorf("expected the expired NSEC RR to be dropped, got %s", got)
+	}
+
+	now := time.Now()
+	z := cache.zones["example."]
+	for name, expected := range map[string]string{
+		"a.example.":   "",
+		"bb.example.":  "b.example.",
+		"x.b.example.": "b.example.",
+		"c.example.":   "",
+		"dz.example.":  "d.example.",
+		"g.example.":   "f.example.",
+	} {
+		got := ""
+		if set := z.coveringNSEC(name, now); set != nil {
+			got = set.rrs[0].Header().Name
+		}
+		if got != expected {
+			t.Errorf("%s: expected covering NSEC RR %q, got %q", name, expected, got)
+		}
+	}
+}
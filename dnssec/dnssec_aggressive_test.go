@@ -0,0 +1,121 @@
+package dnssec_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestAggressiveNSEC(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add(
+		"www 300 IN A 192.0.2.1",
+		"*.wild 300 IN A 192.0.2.9",
+	)
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name, synthesized string
+		qtype             uint16
+		rcode             int
+		answers           int
+	}{
+		{"a.example.", "b.example.", dns.TypeA, dns.RcodeNameError, 0},
+		{"www.example.", "www.example.", dns.TypeAAAA, dns.RcodeSuccess, 0},
+		{"x.wild.example.", "y.wild.example.", dns.TypeA, dns.RcodeSuccess, 1},
+	} {
+		if _, err = resolver.Resolve(tc.name, tc.qtype); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		tree.ResetQueries()
+		qtype := tc.qtype
+		if tc.name == tc.synthesized {
+			qtype = dns.TypeTXT
+		}
+		msg, err := resolver.Resolve(tc.synthesized, qtype)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.synthesized, err)
+		}
+		if msg.Rcode != tc.rcode || countType(msg.Answer, qtype) != tc.answers {
+			t.Errorf("%s: unexpected synthesized answer %v", tc.synthesized, msg)
+		}
+		if queries := tree.Queries(); len(queries) > 0 {
+			t.Errorf("%s: expected answer from validated NSEC RRs, got upstream queries %v", tc.synthesized, queries)
+		}
+	}
+
+	resolver, err = dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+		dnssec.WithoutAggressiveNSEC(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = resolver.Resolve("a.example.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	tree.ResetQueries()
+	if _, err = resolver.Resolve("b.example.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Queries()) == 0 {
+		t.Error("expected upstream query without aggressive NSEC")
+	}
+}
+
+func TestAggressiveNSEC3(t *testing.T) {
+	tree := dnstest.NewTree()
+	hashed := tree.AddZone("hashed.").Add("www 300 IN A 192.0.2.1")
+	hashed.NSEC3 = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := resolver.Resolve("a.hashed.", dns.TypeA)
+	if err != nil || msg.Rcode != dns.RcodeNameError {
+		t.Fatalf("expected secure NXDOMAIN, got %v %v", err, msg)
+	}
+
+	// find another name whose hash falls into a range denied by the answer
+	var name string
+	for i := 0; name == "" && i < 1000; i++ {
+		candidate := fmt.Sprintf("n%d.hashed.", i)
+		for _, rr := range msg.Ns {
+			if nsec3, ok := rr.(*dns.NSEC3); ok && !nsec3.Match(candidate) && nsec3.Cover(candidate) && !nsec3.Cover("a.hashed.") {
+				name = candidate
+			}
+		}
+	}
+	if name == "" {
+		t.Skip("no name covered by the NSEC3 RRs of the answer")
+	}
+	tree.ResetQueries()
+	if msg, err = resolver.Resolve(name, dns.TypeA); err != nil || msg.Rcode != dns.RcodeNameError {
+		t.Errorf("expected synthesized NXDOMAIN for %s, got %v %v", name, err, msg)
+	}
+	if queries := tree.Queries(); len(queries) > 0 {
+		t.Errorf("expected answer from validated NSEC3 RRs, got upstream queries %v", queries)
+	}
+}
+
+func countType(rrs []dns.RR, typ uint16) (n int) {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == typ {
+			n++
+		}
+	}
+	return
+}
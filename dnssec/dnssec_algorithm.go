@@ -0,0 +1,272 @@
+package dnssec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// SignatureVerifier checks an RRSIG signature for one DNSKEY algorithm.
+// publicKey is the decoded Public Key field of the DNSKEY RR, signedData the
+// data reconstructed as described in [rfc4035] 5.3.2 and signature the
+// decoded Signature field of the RRSIG RR.
+type SignatureVerifier interface {
+	Verify(publicKey, signedData, signature []byte) error
+}
+
+type SignatureVerifierFunc func(publicKey, signedData, signature []byte) error
+
+func (f SignatureVerifierFunc) Verify(publicKey, signedData, signature []byte) error {
+	return f(publicKey, signedData, signature)
+}
+
+var (
+	algorithms      = make(map[uint8]SignatureVerifier)
+	algorithmsMutex sync.RWMutex
+)
+
+// RegisterAlgorithm makes verifier check every RRSIG RR of algorithm, e.g. to
+// add a private algorithm or to replace a built-in implementation with a
+// hardware accelerated or FIPS validated one. Registering a nil verifier
+// removes support for the algorithm.
+func RegisterAlgorithm(algorithm uint8, verifier SignatureVerifier) {
+	algorithmsMutex.Lock()
+	defer algorithmsMutex.Unlock()
+	// verifications by the previous verifier must not be trusted any longer
+	if cache := currentSignatureCache(); cache != nil {
+		cache.Purge()
+	}
+	if verifier == nil {
+		delete(algorithms, algorithm)
+	} else {
+		algorithms[algorithm] = verifier
+	}
+}
+
+// RegisteredAlgorithm returns the verifier used for algorithm, if any.
+func RegisteredAlgorithm(algorithm uint8) (verifier SignatureVerifier, ok bool) {
+	algorithmsMutex.RLock()
+	verifier, ok = algorithms[algorithm]
+	algorithmsMutex.RUnlock()
+	return
+}
+
+// VerifyRRSIG authenticates rrset with rrsig and dnskey, checking the
+// conditions of [rfc4035] 5.3.1 before the signature itself using the
+// verifier registered for the algorithm. Successful verifications are
+// remembered in the signature cache until the RRSIG RR expires.
+func VerifyRRSIG(rrsig *dns.RRSIG, dnskey *dns.DNSKEY, rrset []dns.RR) (err error) {
+	// o  The RRSIG RR and the RRset MUST have the same owner name and the
+	//    same class.
+	// o  The RRSIG RR's Type Covered field MUST equal the RRset's type.
+	if !dns.IsRRset(rrset) {
+		err = dns.ErrRRset
+		return
+	}
+	hdr := rrset[0].Header()
+	if !strings.EqualFold(hdr.Name, rrsig.Hdr.Name) || hdr.Class != rrsig.Hdr.Class || hdr.Rrtype != rrsig.TypeCovered {
+		err = dns.ErrRRset
+		return
+	}
+
+	// o  The RRSIG RR's Signer's Name field MUST be the name of the zone
+	//    that contains the RRset.
+	// o  The number of labels in the RRset owner name MUST be greater than
+	//    or equal to the value in the RRSIG RR's Labels field.
+	if !dns.IsSubDomain(rrsig.SignerName, hdr.Name) || int(rrsig.Labels) > dns.CountLabel(hdr.Name) {
+		err = dns.ErrRRset
+		return
+	}
+
+	// o  The RRSIG RR's Signer's Name, Algorithm, and Key Tag fields MUST
+	//    match the owner name, algorithm, and key tag for some DNSKEY RR in
+	//    the zone's apex DNSKEY RRset.
+	// o  The matching DNSKEY RR MUST be present in the zone's apex DNSKEY
+	//    RRset, and MUST have the Zone Flag bit (DNSKEY RDATA Flag bit 7)
+	//    set.
+	if !strings.EqualFold(rrsig.SignerName, dnskey.Hdr.Name) || rrsig.Algorithm != dnskey.Algorithm ||
+		rrsig.KeyTag != dnskey.KeyTag() || rrsig.Hdr.Class != dnskey.Hdr.Class ||
+		dnskey.Protocol != 3 || dnskey.Flags&dns.ZONE == 0 {
+		err = dns.ErrKey
+		return
+	}
+
+	// o  The validator's notion of the current time MUST be less than or
+	//    equal to the time listed in the RRSIG RR's Expiration field.
+	// o  The validator's notion of the current time MUST be greater than or
+	//    equal to the time listed in the RRSIG RR's Inception field.
+	if !rrsig.ValidityPeriod(time.Now()) {
+		err = fmt.Errorf("RRSIG is outside of its validity period %s - %s",
+			dns.TimeToString(rrsig.Inception), dns.TimeToString(rrsig.Expiration))
+		return
+	}
+
+	verifier, ok := RegisteredAlgorithm(rrsig.Algorithm)
+	if !ok {
+		err = dns.ErrAlg
+		return
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(dnskey.PublicKey)
+	if err != nil {
+		err = dns.ErrKey
+		return
+	}
+	signature, err := base64.StdEncoding.DecodeString(rrsig.Signature)
+	if err != nil {
+		err = dns.ErrSig
+		return
+	}
+	signedData, err := SignedData(rrsig, rrset)
+	if err != nil {
+		return
+	}
+	cache := currentSignatureCache()
+	if cache == nil {
+		err = verifier.Verify(publicKey, signedData, signature)
+		return
+	}
+	now := time.Now()
+	key := signatureCacheKey(signedData, signature, dnskey)
+	if cache.lookup(key, now) {
+		return
+	}
+	if err = verifier.Verify(publicKey, signedData, signature); err == nil {
+		cache.add(key, rrsigTime(rrsig.Expiration, now))
+	}
+	return
+}
+
+// SignedData reconstructs the data signed by rrsig over rrset as described in
+// [rfc4035] 5.3.2: the RRSIG RDATA without the signature followed by the RRs
+// of rrset in canonical form and order.
+func SignedData(rrsig *dns.RRSIG, rrset []dns.RR) (data []byte, err error) {
+	sigHeader := &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: ".", Rrtype: dns.TypeRRSIG, Class: rrsig.Hdr.Class},
+		TypeCovered: rrsig.TypeCovered,
+		Algorithm:   rrsig.Algorithm,
+		Labels:      rrsig.Labels,
+		OrigTtl:     rrsig.OrigTtl,
+		Expiration:  rrsig.Expiration,
+		Inception:   rrsig.Inception,
+		KeyTag:      rrsig.KeyTag,
+		SignerName:  dns.CanonicalName(rrsig.SignerName),
+	}
+	if data, err = packRdata(sigHeader); err != nil {
+		return
+	}
+
+	wires := make([][]byte, 0, len(rrset))
+	for _, rr := range rrset {
+		var wire []byte
+		if wire, err = canonicalRR(rr, rrsig); err != nil {
+			return
+		}
+		wires = append(wires, wire)
+	}
+
+	// [rfc4034] 6.3. RRs are sorted by their RDATA as left-justified unsigned
+	// octet sequences, which follows the equal owner name and 10 octets of
+	// type, class, TTL and RDATA length.
+	sort.Slice(wires, func(i, j int) bool {
+		return bytes.Compare(rdataOf(wires[i]), rdataOf(wires[j])) < 0
+	})
+	for i, wire := range wires {
+		if i > 0 && bytes.Equal(wire, wires[i-1]) {
+			continue
+		}
+		data = append(data, wire...)
+	}
+	return
+}
+
+// packRdata returns the RDATA of rr in uncompressed wire format.
+func packRdata(rr dns.RR) (rdata []byte, err error) {
+	wire := make([]byte, dns.Len(rr)+1)
+	off, err := dns.PackRR(rr, wire, 0, nil, false)
+	if err != nil {
+		return
+	}
+	rdata = rdataOf(wire[:off])
+	return
+}
+
+// rdataOf returns the RDATA of an uncompressed RR in wire format.
+func rdataOf(wire []byte) []byte {
+	_, off, _ := dns.UnpackDomainName(wire, 0)
+	return wire[off+10:]
+}
+
+// canonicalRR returns rr in the canonical form of [rfc4034] 6.2 as covered by
+// rrsig: lowercase names, the original TTL and the wildcard owner name it was
+// expanded from.
+func canonicalRR(rr dns.RR, rrsig *dns.RRSIG) (wire []byte, err error) {
+	rr = dns.Copy(rr)
+	h := rr.Header()
+	h.Ttl = rrsig.OrigTtl
+	if labels := dns.SplitDomainName(h.Name); len(labels) > int(rrsig.Labels) {
+		h.Name = dns.Fqdn(strings.Join(append([]string{"*"}, labels[len(labels)-int(rrsig.Labels):]...), "."))
+	}
+	h.Name = dns.CanonicalName(h.Name)
+
+	// [rfc4034] 6.2. (3) with the corrections of [rfc6840] 5.1.
+	switch x := rr.(type) {
+	case *dns.NS:
+		x.Ns = dns.CanonicalName(x.Ns)
+	case *dns.MD:
+		x.Md = dns.CanonicalName(x.Md)
+	case *dns.MF:
+		x.Mf = dns.CanonicalName(x.Mf)
+	case *dns.CNAME:
+		x.Target = dns.CanonicalName(x.Target)
+	case *dns.SOA:
+		x.Ns = dns.CanonicalName(x.Ns)
+		x.Mbox = dns.CanonicalName(x.Mbox)
+	case *dns.MB:
+		x.Mb = dns.CanonicalName(x.Mb)
+	case *dns.MG:
+		x.Mg = dns.CanonicalName(x.Mg)
+	case *dns.MR:
+		x.Mr = dns.CanonicalName(x.Mr)
+	case *dns.PTR:
+		x.Ptr = dns.CanonicalName(x.Ptr)
+	case *dns.MINFO:
+		x.Rmail = dns.CanonicalName(x.Rmail)
+		x.Email = dns.CanonicalName(x.Email)
+	case *dns.MX:
+		x.Mx = dns.CanonicalName(x.Mx)
+	case *dns.RP:
+		x.Mbox = dns.CanonicalName(x.Mbox)
+		x.Txt = dns.CanonicalName(x.Txt)
+	case *dns.AFSDB:
+		x.Hostname = dns.CanonicalName(x.Hostname)
+	case *dns.RT:
+		x.Host = dns.CanonicalName(x.Host)
+	case *dns.SIG:
+		x.SignerName = dns.CanonicalName(x.SignerName)
+	case *dns.PX:
+		x.Map822 = dns.CanonicalName(x.Map822)
+		x.Mapx400 = dns.CanonicalName(x.Mapx400)
+	case *dns.NAPTR:
+		x.Replacement = dns.CanonicalName(x.Replacement)
+	case *dns.KX:
+		x.Exchanger = dns.CanonicalName(x.Exchanger)
+	case *dns.SRV:
+		x.Target = dns.CanonicalName(x.Target)
+	case *dns.DNAME:
+		x.Target = dns.CanonicalName(x.Target)
+	}
+
+	wire = make([]byte, dns.Len(rr)+1)
+	off, err := dns.PackRR(rr, wire, 0, nil, false)
+	if err != nil {
+		return
+	}
+	wire = wire[:off]
+	return
+}
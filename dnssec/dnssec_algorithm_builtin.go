@@ -0,0 +1,105 @@
+package dnssec
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"math/big"
+
+	"github.com/cloudflare/circl/sign/ed448"
+	"github.com/miekg/dns"
+)
+
+func init() {
+	RegisterAlgorithm(dns.RSASHA1, rsaVerifier(crypto.SHA1))
+	RegisterAlgorithm(dns.RSASHA1NSEC3SHA1, rsaVerifier(crypto.SHA1))
+	RegisterAlgorithm(dns.RSASHA256, rsaVerifier(crypto.SHA256))
+	RegisterAlgorithm(dns.RSASHA512, rsaVerifier(crypto.SHA512))
+	RegisterAlgorithm(dns.ECDSAP256SHA256, ecdsaVerifier(elliptic.P256(), crypto.SHA256))
+	RegisterAlgorithm(dns.ECDSAP384SHA384, ecdsaVerifier(elliptic.P384(), crypto.SHA384))
+	RegisterAlgorithm(dns.ED25519, SignatureVerifierFunc(verifyEd25519))
+	RegisterAlgorithm(dns.ED448, SignatureVerifierFunc(verifyEd448))
+}
+
+// [rfc3110] 2. RSA Public KEY Resource Records
+func rsaVerifier(hash crypto.Hash) SignatureVerifier {
+	return SignatureVerifierFunc(func(publicKey, signedData, signature []byte) (err error) {
+		if len(publicKey) < 3 {
+			return dns.ErrKey
+		}
+		expLen, keyOff := int(publicKey[0]), 1
+		if expLen == 0 {
+			expLen, keyOff = int(publicKey[1])<<8|int(publicKey[2]), 3
+		}
+		modOff := keyOff + expLen
+		if expLen == 0 || expLen > 4 || modOff >= len(publicKey) || publicKey[keyOff] == 0 {
+			return dns.ErrKey
+		}
+		modLen := len(publicKey) - modOff
+		if modLen < 64 || modLen > 512 || publicKey[modOff] == 0 {
+			return dns.ErrKey
+		}
+		var exp uint64
+		for _, b := range publicKey[keyOff:modOff] {
+			exp = exp<<8 | uint64(b)
+		}
+		if exp > 1<<31-1 {
+			return dns.ErrKey
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(publicKey[modOff:]), E: int(exp)}
+		h := hash.New()
+		h.Write(signedData)
+		return rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), signature)
+	})
+}
+
+// [rfc6605] 4. DNSKEY and RRSIG Resource Records for ECDSA
+func ecdsaVerifier(curve elliptic.Curve, hash crypto.Hash) SignatureVerifier {
+	size := (curve.Params().BitSize + 7) / 8
+	return SignatureVerifierFunc(func(publicKey, signedData, signature []byte) (err error) {
+		if len(publicKey) != 2*size {
+			return dns.ErrKey
+		}
+		if len(signature) != 2*size {
+			return dns.ErrSig
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(publicKey[:size]),
+			Y:     new(big.Int).SetBytes(publicKey[size:]),
+		}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return dns.ErrKey
+		}
+		h := hash.New()
+		h.Write(signedData)
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, h.Sum(nil), r, s) {
+			return dns.ErrSig
+		}
+		return
+	})
+}
+
+// [rfc8080] 3. DNSKEY and RRSIG Resource Records for Ed25519 and Ed448
+func verifyEd25519(publicKey, signedData, signature []byte) (err error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return dns.ErrKey
+	}
+	if !ed25519.Verify(publicKey, signedData, signature) {
+		return dns.ErrSig
+	}
+	return
+}
+
+func verifyEd448(publicKey, signedData, signature []byte) (err error) {
+	if len(publicKey) != ed448.PublicKeySize {
+		return dns.ErrKey
+	}
+	if len(signature) != ed448.SignatureSize || !ed448.Verify(publicKey, signedData, signature, "") {
+		return dns.ErrSig
+	}
+	return
+}
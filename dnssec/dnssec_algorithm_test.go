@@ -0,0 +1,120 @@
+package dnssec_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/circl/sign/ed448"
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestBuiltinAlgorithms(t *testing.T) {
+	tree := dnstest.NewTree()
+	algorithms := map[string]uint8{
+		"rsasha1.":   dns.RSASHA1,
+		"rsasha256.": dns.RSASHA256,
+		"rsasha512.": dns.RSASHA512,
+		"ecdsa384.":  dns.ECDSAP384SHA384,
+		"ed25519.":   dns.ED25519,
+	}
+	for zone, algorithm := range algorithms {
+		z := tree.AddZone(zone)
+		tree.Resign(z, algorithm, dns.SHA256)
+		z.Add("www 300 IN A 192.0.2.1")
+	}
+	resolver, err := dnssec.New(dnssec.WithTrustAnchors(tree.TrustAnchors()), dnssec.WithDNSResolver(tree))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for zone := range algorithms {
+		if _, err = resolver.Resolve("www."+zone, dns.TypeA); err != nil {
+			t.Errorf("%s: %v", zone, err)
+		}
+	}
+}
+
+func newTestRRSIG(key *dns.DNSKEY, rrset []dns.RR) *dns.RRSIG {
+	now := time.Now()
+	return &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: rrset[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 300},
+		TypeCovered: rrset[0].Header().Rrtype,
+		Algorithm:   key.Algorithm,
+		Labels:      uint8(dns.CountLabel(rrset[0].Header().Name)),
+		OrigTtl:     rrset[0].Header().Ttl,
+		Expiration:  uint32(now.Add(time.Hour).Unix()),
+		Inception:   uint32(now.Add(-time.Hour).Unix()),
+		KeyTag:      key.KeyTag(),
+		SignerName:  key.Hdr.Name,
+	}
+}
+
+func TestEd448(t *testing.T) {
+	pub, priv, err := ed448.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "example.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE,
+		Protocol:  3,
+		Algorithm: dns.ED448,
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+	}
+	rrset := []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: "www.Example.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: []byte{192, 0, 2, 2}},
+		&dns.A{Hdr: dns.RR_Header{Name: "www.Example.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: []byte{192, 0, 2, 1}},
+	}
+	rrsig := newTestRRSIG(key, rrset)
+	data, err := dnssec.SignedData(rrsig, rrset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rrsig.Signature = base64.StdEncoding.EncodeToString(ed448.Sign(priv, data, ""))
+
+	if err = dnssec.VerifyRRSIG(rrsig, key, rrset); err != nil {
+		t.Errorf("expected Ed448 signature to verify, got %v", err)
+	}
+	rrset[0].(*dns.A).A = []byte{192, 0, 2, 3}
+	if err = dnssec.VerifyRRSIG(rrsig, key, rrset); err == nil {
+		t.Error("expected Ed448 signature over modified RRset to fail")
+	}
+}
+
+func TestRegisterAlgorithm(t *testing.T) {
+	const algorithm = 250
+	dnssec.RegisterAlgorithm(algorithm, dnssec.SignatureVerifierFunc(func(publicKey, signedData, signature []byte) error {
+		if !bytes.Equal(signature, append(publicKey, signedData...)) {
+			return dns.ErrSig
+		}
+		return nil
+	}))
+	defer dnssec.RegisterAlgorithm(algorithm, nil)
+
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "example.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE,
+		Protocol:  3,
+		Algorithm: algorithm,
+		PublicKey: base64.StdEncoding.EncodeToString([]byte("key")),
+	}
+	rrset := []dns.RR{&dns.TXT{Hdr: dns.RR_Header{Name: "example.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{"hello"}}}
+	rrsig := newTestRRSIG(key, rrset)
+	data, err := dnssec.SignedData(rrsig, rrset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rrsig.Signature = base64.StdEncoding.EncodeToString(append([]byte("key"), data...))
+	if err = dnssec.VerifyRRSIG(rrsig, key, rrset); err != nil {
+		t.Errorf("expected registered verifier to accept signature, got %v", err)
+	}
+
+	dnssec.RegisterAlgorithm(algorithm, nil)
+	if err = dnssec.VerifyRRSIG(rrsig, key, rrset); err != dns.ErrAlg {
+		t.Errorf("expected ErrAlg after removing the verifier, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package dnssec
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrCacheMiss is returned by a CacheBackend when it holds no unexpired value
+// for a key.
+var ErrCacheMiss = errors.New("cache miss")
+
+// CacheBackend stores opaque values which may be shared between resolvers,
+// e.g. by a fleet of workers talking to the same key-value service. Values
+// are stored until their expiration time and must not be returned after it.
+type CacheBackend interface {
+	Get(key string) (value []byte, err error)
+	Set(key string, value []byte, expiration time.Time) error
+	Delete(key string) error
+}
+
+// MemoryCache is a CacheBackend keeping values in the memory of the process.
+type MemoryCache struct {
+	mutex   sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	value      []byte
+	expiration time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries: make(map[string]memoryCacheEntry),
+	}
+}
+
+func (c *MemoryCache) Get(key string) (value []byte, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		err = ErrCacheMiss
+		return
+	}
+	if time.Now().After(entry.expiration) {
+		delete(c.entries, key)
+		err = ErrCacheMiss
+		return
+	}
+	value = append([]byte(nil), entry.value...)
+	return
+}
+
+func (c *MemoryCache) Set(key string, value []byte, expiration time.Time) (err error) {
+	c.mutex.Lock()
+	c.entries[key] = memoryCacheEntry{
+		value:      append([]byte(nil), value...),
+		expiration: expiration,
+	}
+	c.mutex.Unlock()
+	return
+}
+
+func (c *MemoryCache) Delete(key string) (err error) {
+	c.mutex.Lock()
+	delete(c.entries, key)
+	c.mutex.Unlock()
+	return
+}
+
+// Prune drops every entry that expired before the time now.
+func (c *MemoryCache) Prune(now time.Time) {
+	c.mutex.Lock()
+	for key, entry := range c.entries {
+		if now.After(entry.expiration) {
+			delete(c.entries, key)
+		}
+	}
+	c.mutex.Unlock()
+}
+
+// FileCache is a CacheBackend keeping one file per value in a directory, which
+// may be shared by several processes on the same host.
+type FileCache struct {
+	dir string
+}
+
+func NewFileCache(dir string) (cache *FileCache, err error) {
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return
+	}
+	cache = &FileCache{dir: dir}
+	return
+}
+
+func (c *FileCache) Get(key string) (value []byte, err error) {
+	data, err := os.ReadFile(c.path(key))
+	if os.IsNotExist(err) {
+		err = ErrCacheMiss
+		return
+	}
+	if err != nil {
+		return
+	}
+	if len(data) < 8 {
+		err = fmt.Errorf("truncated cache file for key %q", key)
+		return
+	}
+	if time.Now().After(time.Unix(int64(binary.BigEndian.Uint64(data)), 0)) {
+		os.Remove(c.path(key))
+		err = ErrCacheMiss
+		return
+	}
+	value = data[8:]
+	return
+}
+
+func (c *FileCache) Set(key string, value []byte, expiration time.Time) (err error) {
+	f, err := os.CreateTemp(c.dir, ".tmp.*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	var header [8]byte
+	binary.BigEndian.PutUint64(header[:], uint64(expiration.Unix()))
+	if _, err = f.Write(header[:]); err != nil {
+		return
+	}
+	if _, err = f.Write(value); err != nil {
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	err = os.Rename(f.Name(), c.path(key))
+	return
+}
+
+func (c *FileCache) Delete(key string) (err error) {
+	if err = os.Remove(c.path(key)); os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+func (c *FileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// sealedCache authenticates every value it stores in the wrapped backend with
+// an HMAC over the key, the expiration and the value. Values that fail the
+// check or have expired are treated as missing, so whoever can write to a
+// shared backend still cannot inject zone keys or responses into the
+// resolvers using it, nor replay them once they expired.
+type sealedCache struct {
+	backend CacheBackend
+	hmacKey []byte
+}
+
+func (c *sealedCache) Get(key string) (value []byte, err error) {
+	data, err := c.backend.Get(key)
+	if err != nil {
+		return
+	}
+	const header = sha256.Size + 8
+	if len(data) < header || !hmac.Equal(data[:sha256.Size], c.mac(key, data[sha256.Size:])) {
+		c.backend.Delete(key)
+		err = ErrCacheMiss
+		return
+	}
+	expiration := time.Unix(int64(binary.BigEndian.Uint64(data[sha256.Size:header])), 0)
+	if time.Now().After(expiration) {
+		c.backend.Delete(key)
+		err = ErrCacheMiss
+		return
+	}
+	value = data[header:]
+	return
+}
+
+func (c *sealedCache) Set(key string, value []byte, expiration time.Time) error {
+	data := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(data, uint64(expiration.Unix()))
+	data = append(data, value...)
+	return c.backend.Set(key, append(c.mac(key, data), data...), expiration)
+}
+
+func (c *sealedCache) Delete(key string) error {
+	return c.backend.Delete(key)
+}
+
+// mac authenticates key and data, which is the expiration followed by the
+// value.
+func (c *sealedCache) mac(key string, data []byte) []byte {
+	h := hmac.New(sha256.New, c.hmacKey)
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(key)))
+	h.Write(n[:])
+	h.Write([]byte(key))
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,98 @@
+package dnssec
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestSharedKeyStore(t *testing.T) {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "example.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE,
+		Protocol:  3,
+		Algorithm: dns.ED25519,
+	}
+	if _, err := key.Generate(256); err != nil {
+		t.Fatal(err)
+	}
+	keys := NewKeySet(key)
+	validity := Validity{NotAfter: time.Now().Add(time.Hour)}
+
+	for _, name := range []string{"memory", "file"} {
+		var backend CacheBackend = NewMemoryCache()
+		if name == "file" {
+			var err error
+			if backend, err = NewFileCache(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		writer, reader := newSealedKeyStore(backend), newSealedKeyStore(backend)
+
+		writer.Add("example.", "example.", keys, validity)
+		writer.Add("www.example.", "example.", keys, validity)
+		if zone, got := reader.Get("www.example."); zone != "example." || got[key.KeyTag()] == nil {
+			t.Errorf("%s: expected keys of example. from shared backend, got %q %v", name, zone, got)
+		}
+
+		// a value written without knowing the HMAC key must be ignored
+		data, err := backend.Get("keystore/delegation/www.example.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-2] ^= 0xff
+		backend.Set("keystore/delegation/mail.example.", data, validity.NotAfter)
+		if zone, got := newSealedKeyStore(backend).Get("mail.example."); zone != "" || got != nil {
+			t.Errorf("%s: expected tampered entry to be rejected, got %q %v", name, zone, got)
+		}
+	}
+}
+
+func newSealedKeyStore(backend CacheBackend) *KeyStore {
+	ks := NewKeyStore(nil)
+	ks.SetBackend(&sealedCache{backend: backend, hmacKey: []byte("0123456789abcdef")})
+	return ks
+}
+
+// replayCache is a compromised backend returning values after they expired.
+type replayCache map[string][]byte
+
+func (c replayCache) Get(key string) ([]byte, error) {
+	if value, ok := c[key]; ok {
+		return value, nil
+	}
+	return nil, ErrCacheMiss
+}
+
+func (c replayCache) Set(key string, value []byte, expiration time.Time) error {
+	c[key] = value
+	return nil
+}
+
+func (c replayCache) Delete(key string) error {
+	delete(c, key)
+	return nil
+}
+
+func TestSealedCacheExpiration(t *testing.T) {
+	backend := make(replayCache)
+	sealed := &sealedCache{backend: backend, hmacKey: []byte("0123456789abcdef")}
+
+	sealed.Set("fresh", []byte("value"), time.Now().Add(time.Hour))
+	if value, err := sealed.Get("fresh"); err != nil || string(value) != "value" {
+		t.Errorf("expected unexpired value, got %q %v", value, err)
+	}
+	sealed.Set("stale", []byte("value"), time.Now().Add(-time.Second))
+	if value, err := sealed.Get("stale"); err != ErrCacheMiss {
+		t.Errorf("expected replayed expired value to be a miss, got %q %v", value, err)
+	}
+
+	// extending the expiration without the HMAC key must fail
+	sealed.Set("extended", []byte("value"), time.Now().Add(-time.Second))
+	backend["extended"][sha256.Size] ^= 0x7f
+	if value, err := sealed.Get("extended"); err != ErrCacheMiss {
+		t.Errorf("expected tampered expiration to be rejected, got %q %v", value, err)
+	}
+}
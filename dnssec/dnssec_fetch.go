@@ -0,0 +1,92 @@
+package dnssec
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultRefreshAhead is how long before they expire the keys of a zone are
+// verified again in the background when they are used.
+const DefaultRefreshAhead = time.Minute
+
+// zoneFetch is a pair of DNSKEY and DS queries for a name that may still be in
+// flight. The messages may be read once done is closed.
+type zoneFetch struct {
+	done      chan struct{}
+	dnskeyMsg *dns.Msg
+	dsMsg     *dns.Msg
+	err       error
+}
+
+// fetchZone starts querying the DNSKEY and DS RRsets of fqdn in parallel. The
+// queries are abandoned once ctx is done.
+func (resolver *Resolver) fetchZone(ctx context.Context, fqdn string) (fetch *zoneFetch) {
+	fetch = &zoneFetch{done: make(chan struct{})}
+	go func() {
+		defer close(fetch.done)
+		var (
+			wg               sync.WaitGroup
+			dnskeyErr, dsErr error
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			fetch.dnskeyMsg, dnskeyErr = resolver.queryRRset(ctx, fqdn, dns.TypeDNSKEY)
+		}()
+		go func() {
+			defer wg.Done()
+			fetch.dsMsg, dsErr = resolver.queryRRset(ctx, fqdn, dns.TypeDS)
+		}()
+		wg.Wait()
+		if fetch.err = dnskeyErr; fetch.err == nil {
+			fetch.err = dsErr
+		}
+	}()
+	return
+}
+
+func (resolver *Resolver) queryRRset(ctx context.Context, fqdn string, typ uint16) (resp *dns.Msg, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	msg := new(dns.Msg)
+	msg.SetEdns0(4096, true)
+	msg.SetQuestion(fqdn, typ)
+	if r, ok := resolver.dnsResolver.(ContextDNSResolver); ok {
+		resp, err = r.QueryContext(ctx, msg)
+		return
+	}
+	resp, err = resolver.dnsResolver.Query(msg)
+	return
+}
+
+// refreshAheadOf verifies the keys of fqdn again in the background when they
+// expire within the refresh ahead window, so lookups keep finding them in the
+// keystore. Trust anchors never expire and are not refreshed.
+func (resolver *Resolver) refreshAheadOf(fqdn string) {
+	if resolver.refreshAhead <= 0 || fqdn == "." {
+		return
+	}
+	notAfter := resolver.keystore.Validity(fqdn).NotAfter
+	if notAfter.IsZero() || time.Until(notAfter) > resolver.refreshAhead {
+		return
+	}
+	resolver.refreshMutex.Lock()
+	if resolver.refreshing[fqdn] {
+		resolver.refreshMutex.Unlock()
+		return
+	}
+	resolver.refreshing[fqdn] = true
+	resolver.refreshMutex.Unlock()
+
+	go func() {
+		fetches := map[string]*zoneFetch{fqdn: resolver.fetchZone(context.Background(), fqdn)}
+		resolver.verifyZoneKeys(fqdn, fetches, true, nil)
+		resolver.refreshMutex.Lock()
+		delete(resolver.refreshing, fqdn)
+		resolver.refreshMutex.Unlock()
+	}()
+}
@@ -0,0 +1,149 @@
+package dnssec_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+// slowResolver delays every query and records how many were in flight at
+// the same time.
+type slowResolver struct {
+	tree *dnstest.Tree
+
+	mutex       sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (r *slowResolver) Query(msg *dns.Msg) (resp *dns.Msg, err error) {
+	r.mutex.Lock()
+	if r.inFlight++; r.inFlight > r.maxInFlight {
+		r.maxInFlight = r.inFlight
+	}
+	r.mutex.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	r.mutex.Lock()
+	r.inFlight--
+	r.mutex.Unlock()
+	return r.tree.Query(msg)
+}
+
+func TestParallelChainFetch(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("com.")
+	tree.AddZone("example.com.").Add("www 300 IN A 192.0.2.1")
+
+	slow := &slowResolver{tree: tree}
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(slow),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = resolver.Resolve("www.example.com.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	// the answer and the DNSKEY and DS RRsets of www.example.com.,
+	// example.com. and com.
+	if slow.maxInFlight < 7 {
+		t.Errorf("expected all queries of the chain in flight at once, got at most %d", slow.maxInFlight)
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add("www 300 IN A 192.0.2.1")
+
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+		dnssec.WithRefreshAhead(2*time.Hour),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = resolver.Resolve("www.example.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+
+	tree.ResetQueries()
+	if _, err = resolver.Resolve("www.example.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	refreshed := func() bool {
+		for _, q := range tree.Queries() {
+			if q.Name == "example." && q.Qtype == dns.TypeDNSKEY {
+				return true
+			}
+		}
+		return false
+	}
+	for deadline := time.Now().Add(time.Second); !refreshed() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !refreshed() {
+		t.Error("expected keys of example. to be refreshed ahead of their expiry")
+	}
+	if validity := resolver.KeyStore().Validity("example."); !validity.Covers(time.Now()) {
+		t.Errorf("expected refreshed keys of example. to be valid, got %v", validity)
+	}
+}
+
+// cancelResolver fails the queries for one name and holds those for another
+// one until they are canceled.
+type cancelResolver struct {
+	tree     *dnstest.Tree
+	failing  string
+	held     string
+	canceled chan struct{}
+}
+
+func (r *cancelResolver) Query(msg *dns.Msg) (*dns.Msg, error) {
+	return r.QueryContext(context.Background(), msg)
+}
+
+func (r *cancelResolver) QueryContext(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	switch msg.Question[0].Name {
+	case r.failing:
+		return nil, errors.New("upstream failure")
+	case r.held:
+		select {
+		case <-ctx.Done():
+			r.canceled <- struct{}{}
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+	return r.tree.Query(msg)
+}
+
+func TestCancelChainFetch(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add("a.b 300 IN A 192.0.2.1")
+	upstream := &cancelResolver{tree: tree, failing: "b.example.", held: "a.b.example.", canceled: make(chan struct{}, 2)}
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(upstream),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = resolver.GetVerifiedZoneKeys("a.b.example."); err == nil {
+		t.Fatal("expected failure of the chain")
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-upstream.canceled:
+		case <-time.After(time.Second):
+			t.Fatal("expected queries no longer needed to be canceled")
+		}
+	}
+}
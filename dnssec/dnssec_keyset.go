@@ -0,0 +1,53 @@
+package dnssec
+
+import (
+	"sort"
+
+	"github.com/miekg/dns"
+)
+
+// KeySet holds DNSKEY RRs by their key tag. Key tags are not unique, see
+// [rfc4034] B., so every key sharing a tag is kept and tried in turn. An
+// empty but non-nil KeySet stands for a zone proven to be unsigned.
+type KeySet map[uint16][]*dns.DNSKEY
+
+func NewKeySet(keys ...*dns.DNSKEY) KeySet {
+	ks := make(KeySet)
+	for _, key := range keys {
+		ks.Add(key)
+	}
+	return ks
+}
+
+// Add adds key unless the set already holds a key with the same owner name
+// and RDATA.
+func (ks KeySet) Add(key *dns.DNSKEY) {
+	tag := key.KeyTag()
+	for _, other := range ks[tag] {
+		if dns.IsDuplicate(key, other) {
+			return
+		}
+	}
+	ks[tag] = append(ks[tag], key)
+}
+
+// Len returns the number of keys in the set.
+func (ks KeySet) Len() (n int) {
+	for _, keys := range ks {
+		n += len(keys)
+	}
+	return
+}
+
+// Keys returns every key of the set ordered by key tag.
+func (ks KeySet) Keys() (keys []*dns.DNSKEY) {
+	tags := make([]int, 0, len(ks))
+	for tag := range ks {
+		tags = append(tags, int(tag))
+	}
+	sort.Ints(tags)
+	for _, tag := range tags {
+		keys = append(keys, ks[uint16(tag)]...)
+	}
+	return
+}
@@ -0,0 +1,88 @@
+package dnssec_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+)
+
+func TestKeyTagCollision(t *testing.T) {
+	const algorithm = 252
+	verifications := 0
+	dnssec.RegisterAlgorithm(algorithm, dnssec.SignatureVerifierFunc(func(publicKey, signedData, signature []byte) error {
+		verifications++
+		if !bytes.Equal(signature, append(publicKey, signedData...)) {
+			return dns.ErrSig
+		}
+		return nil
+	}))
+	defer dnssec.RegisterAlgorithm(algorithm, nil)
+
+	// swapping 16 bit words of the public key keeps the key tag, which is a
+	// checksum over the RDATA
+	words := []string{"aa", "bb", "cc", "dd"}
+	var keys []*dns.DNSKEY
+	for i := range words {
+		for j := range words {
+			if i == j {
+				continue
+			}
+			permuted := append([]string(nil), words...)
+			permuted[i], permuted[j] = permuted[j], permuted[i]
+			keys = append(keys, &dns.DNSKEY{
+				Hdr:       dns.RR_Header{Name: "example.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+				Flags:     dns.ZONE,
+				Protocol:  3,
+				Algorithm: algorithm,
+				PublicKey: base64.StdEncoding.EncodeToString([]byte(permuted[0] + permuted[1] + permuted[2] + permuted[3])),
+			})
+		}
+	}
+	keySet := dnssec.NewKeySet(keys...)
+	if len(keySet) != 1 || keySet.Len() != 6 {
+		t.Fatalf("expected 6 distinct keys under one key tag, got %d tags and %d keys", len(keySet), keySet.Len())
+	}
+	keySet.Add(dns.Copy(keys[0]).(*dns.DNSKEY))
+	if keySet.Len() != 6 {
+		t.Errorf("expected duplicate key to be ignored, got %d keys", keySet.Len())
+	}
+
+	rrs := []dns.RR{&dns.TXT{Hdr: dns.RR_Header{Name: "example.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{"hello"}}}
+	signer := keySet[keys[0].KeyTag()][1]
+	rrsig := newTestRRSIG(signer, rrs)
+	data, err := dnssec.SignedData(rrsig, rrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, _ := base64.StdEncoding.DecodeString(signer.PublicKey)
+	rrsig.Signature = base64.StdEncoding.EncodeToString(append(publicKey, data...))
+	rrset := dnssec.SplitRRsets(append(rrs, rrsig))[0]
+
+	if result := rrset.Verify("example.", keySet); result.Status != dnssec.Secure || result.DNSKEY != signer {
+		t.Errorf("expected RRset to verify with the second key of the tag, got %v", result.Status)
+	}
+	limits := dnssec.Limits{MaxKeysPerTag: 1, MaxVerifications: 8}
+	if result := rrset.VerifyWithLimits("example.", keySet, limits); !errors.Is(result.Status, dnssec.ErrBogus) {
+		t.Errorf("expected Bogus beyond the keys tried per key tag, got %v", result.Status)
+	}
+
+	// KeyTrap: many RRSIG RRs and colliding keys, none of which verifies
+	forged := dns.Copy(rrsig).(*dns.RRSIG)
+	forged.Signature = base64.StdEncoding.EncodeToString([]byte("forged"))
+	rrset.RRSIGs = nil
+	for i := 0; i < 10; i++ {
+		rrset.RRSIGs = append(rrset.RRSIGs, forged)
+	}
+	verifications = 0
+	limits = dnssec.Limits{MaxKeysPerTag: 6, MaxVerifications: 8}
+	if result := rrset.VerifyWithLimits("example.", keySet, limits); !errors.Is(result.Status, dnssec.ErrBogus) {
+		t.Errorf("expected Bogus for RRset without valid signature, got %v", result.Status)
+	}
+	if verifications != limits.MaxVerifications {
+		t.Errorf("expected %d signature verifications, got %d", limits.MaxVerifications, verifications)
+	}
+}
@@ -1,57 +1,275 @@
 package dnssec
 
 import (
+	"encoding/json"
 	"sync"
+	"time"
 
 	"github.com/miekg/dns"
 )
 
 type KeyStore struct {
-	mutex          sync.RWMutex
-	store          map[string]map[uint16]*dns.DNSKEY
-	signingZoneMap map[string]string
+	mutex              sync.RWMutex
+	store              map[string]KeySet
+	zoneValidity       map[string]Validity
+	signingZoneMap     map[string]string
+	delegationValidity map[string]Validity
+	backend            CacheBackend
 }
 
-func NewKeyStore(keys map[uint16]*dns.DNSKEY) *KeyStore {
+// Validity is the period during which cached DNSSEC material may be used
+// without verifying it again. A zero NotAfter never expires, which is how
+// trust anchors are stored.
+type Validity struct {
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+func (v Validity) Covers(t time.Time) bool {
+	if !v.NotBefore.IsZero() && t.Before(v.NotBefore) {
+		return false
+	}
+	if !v.NotAfter.IsZero() && t.After(v.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// Intersect narrows v to the period that is also covered by other.
+func (v Validity) Intersect(other Validity) Validity {
+	if other.NotBefore.After(v.NotBefore) {
+		v.NotBefore = other.NotBefore
+	}
+	if !other.NotAfter.IsZero() && (v.NotAfter.IsZero() || other.NotAfter.Before(v.NotAfter)) {
+		v.NotAfter = other.NotAfter
+	}
+	return v
+}
+
+func NewKeyStore(keys KeySet) *KeyStore {
 	ks := &KeyStore{
-		store:          make(map[string]map[uint16]*dns.DNSKEY),
-		signingZoneMap: make(map[string]string),
+		store:              make(map[string]KeySet),
+		zoneValidity:       make(map[string]Validity),
+		signingZoneMap:     make(map[string]string),
+		delegationValidity: make(map[string]Validity),
 	}
-	for _, key := range keys {
+	ks.addTrustAnchors(keys)
+	return ks
+}
+
+func (ks *KeyStore) addTrustAnchors(keys KeySet) {
+	ks.mutex.Lock()
+	for _, key := range keys.Keys() {
+		fqdn := dns.Fqdn(key.Hdr.Name)
+		if !ks.zoneValidity[fqdn].NotAfter.IsZero() {
+			// cached keys of a zone that is now configured as a trust anchor
+			delete(ks.store, fqdn)
+			delete(ks.zoneValidity, fqdn)
+		}
+		ks.signingZoneMap[fqdn] = fqdn
+		delete(ks.delegationValidity, fqdn)
 		ks.addLocked(key)
 	}
-	return ks
+	ks.mutex.Unlock()
 }
 
-func (ks *KeyStore) Get(fqdn string) (signingZoneFqdn string, signingZoneKeys map[uint16]*dns.DNSKEY) {
+func (ks *KeyStore) Get(fqdn string) (signingZoneFqdn string, signingZoneKeys KeySet) {
+	now := time.Now()
 	ks.mutex.RLock()
-	signingZoneFqdn = ks.signingZoneMap[fqdn]
-	signingZoneKeys = ks.store[fqdn]
+	signingZoneFqdn, signingZoneKeys = ks.getLocked(fqdn, now)
+	backend := ks.backend
 	ks.mutex.RUnlock()
+	if signingZoneKeys == nil && backend != nil && ks.loadShared(backend, fqdn, now) {
+		ks.mutex.RLock()
+		signingZoneFqdn, signingZoneKeys = ks.getLocked(fqdn, now)
+		ks.mutex.RUnlock()
+	}
 	return
 }
 
-func (ks *KeyStore) Add(childZoneFqdn, signingZoneFqdn string, signingZoneKeys map[uint16]*dns.DNSKEY) {
+func (ks *KeyStore) getLocked(fqdn string, now time.Time) (signingZoneFqdn string, signingZoneKeys KeySet) {
+	if !ks.delegationValidity[fqdn].Covers(now) {
+		return
+	}
+	signingZoneFqdn = ks.signingZoneMap[fqdn]
+	if signingZoneFqdn == "" || !ks.zoneValidity[signingZoneFqdn].Covers(now) {
+		signingZoneFqdn = ""
+		return
+	}
+	signingZoneKeys = ks.store[signingZoneFqdn]
+	return
+}
+
+// Validity returns the period during which the keys returned by Get for fqdn
+// remain usable, which is zero if there are none.
+func (ks *KeyStore) Validity(fqdn string) (validity Validity) {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+	signingZoneFqdn, ok := ks.signingZoneMap[fqdn]
+	if !ok {
+		return
+	}
+	validity = ks.delegationValidity[fqdn].Intersect(ks.zoneValidity[signingZoneFqdn])
+	return
+}
+
+func (ks *KeyStore) Add(childZoneFqdn, signingZoneFqdn string, signingZoneKeys KeySet, validity Validity) {
 	ks.mutex.Lock()
 	ks.signingZoneMap[childZoneFqdn] = signingZoneFqdn
-	for _, key := range signingZoneKeys {
-		ks.addLocked(key)
+	ks.delegationValidity[childZoneFqdn] = validity
+	if childZoneFqdn == signingZoneFqdn {
+		// the child is a zone apex, so these are its freshly verified keys,
+		// none at all if the zone is insecure
+		ks.store[signingZoneFqdn] = NewKeySet()
+		for _, key := range signingZoneKeys.Keys() {
+			ks.addLocked(key)
+		}
+		ks.zoneValidity[signingZoneFqdn] = validity
+	}
+	backend := ks.backend
+	ks.mutex.Unlock()
+	if backend != nil {
+		ks.storeShared(backend, childZoneFqdn, signingZoneFqdn, signingZoneKeys, validity)
+	}
+}
+
+// SetBackend makes the store share the zone keys it verifies through backend
+// and consult it before a zone has to be verified again. The backend should
+// protect the values it returns, like the one set up by WithCacheBackend
+// does, because keys loaded from it are trusted without verification.
+func (ks *KeyStore) SetBackend(backend CacheBackend) {
+	ks.mutex.Lock()
+	ks.backend = backend
+	ks.mutex.Unlock()
+}
+
+func (ks *KeyStore) loadShared(backend CacheBackend, fqdn string, now time.Time) (ok bool) {
+	var delegation keyStoreSnapshotDelegation
+	if data, err := backend.Get("keystore/delegation/" + fqdn); err != nil || json.Unmarshal(data, &delegation) != nil {
+		return
+	}
+	delegationValidity := Validity{NotBefore: delegation.NotBefore, NotAfter: delegation.NotAfter}
+	if delegation.Name != fqdn || delegationValidity.NotAfter.IsZero() || !delegationValidity.Covers(now) {
+		return
+	}
+
+	var (
+		zone         keyStoreSnapshotZone
+		keys         KeySet
+		zoneValidity Validity
+	)
+	ks.mutex.RLock()
+	_, zoneKeys := ks.getLocked(delegation.SigningZone, now)
+	ks.mutex.RUnlock()
+	if zoneKeys == nil {
+		data, err := backend.Get("keystore/zone/" + delegation.SigningZone)
+		if err != nil || json.Unmarshal(data, &zone) != nil || zone.Zone != delegation.SigningZone {
+			return
+		}
+		zoneValidity = Validity{NotBefore: zone.NotBefore, NotAfter: zone.NotAfter}
+		if keys, err = zone.parse(); err != nil || zoneValidity.NotAfter.IsZero() || !zoneValidity.Covers(now) {
+			return
+		}
+	}
+
+	ks.mutex.Lock()
+	if keys != nil {
+		ks.mergeZoneLocked(delegation.SigningZone, keys, zoneValidity)
+	}
+	if fqdn != delegation.SigningZone {
+		ks.signingZoneMap[fqdn] = delegation.SigningZone
+		ks.delegationValidity[fqdn] = delegationValidity
 	}
 	ks.mutex.Unlock()
+	ok = true
+	return
+}
+
+func (ks *KeyStore) storeShared(backend CacheBackend, childZoneFqdn, signingZoneFqdn string, signingZoneKeys KeySet, validity Validity) {
+	if validity.NotAfter.IsZero() {
+		return
+	}
+	if childZoneFqdn == signingZoneFqdn {
+		if data, err := json.Marshal(newKeyStoreSnapshotZone(signingZoneFqdn, signingZoneKeys, validity)); err == nil {
+			backend.Set("keystore/zone/"+signingZoneFqdn, data, validity.NotAfter)
+		}
+	}
+	delegation := keyStoreSnapshotDelegation{
+		Name:        childZoneFqdn,
+		SigningZone: signingZoneFqdn,
+		NotBefore:   validity.NotBefore,
+		NotAfter:    validity.NotAfter,
+	}
+	if data, err := json.Marshal(&delegation); err == nil {
+		backend.Set("keystore/delegation/"+childZoneFqdn, data, validity.NotAfter)
+	}
 }
 
 func (ks *KeyStore) SetEmptyZone(fqdn string) {
 	ks.mutex.Lock()
 	signingZoneFqdn := ks.signingZoneMap[fqdn]
 	delete(ks.store, signingZoneFqdn)
+	delete(ks.zoneValidity, signingZoneFqdn)
 	delete(ks.signingZoneMap, fqdn)
+	delete(ks.delegationValidity, fqdn)
 	ks.mutex.Unlock()
 }
 
+// Prune drops every entry that is no longer valid at the time now.
+func (ks *KeyStore) Prune(now time.Time) {
+	ks.mutex.Lock()
+	ks.pruneLocked(now)
+	ks.mutex.Unlock()
+}
+
+func (ks *KeyStore) pruneLocked(now time.Time) {
+	for zone, validity := range ks.zoneValidity {
+		if !validity.Covers(now) {
+			delete(ks.store, zone)
+			delete(ks.zoneValidity, zone)
+		}
+	}
+	for fqdn, signingZoneFqdn := range ks.signingZoneMap {
+		if _, ok := ks.store[signingZoneFqdn]; !ok || !ks.delegationValidity[fqdn].Covers(now) {
+			delete(ks.signingZoneMap, fqdn)
+			delete(ks.delegationValidity, fqdn)
+		}
+	}
+}
+
 func (ks *KeyStore) addLocked(key *dns.DNSKEY) {
 	fqdn := dns.Fqdn(key.Hdr.Name)
 	if ks.store[fqdn] == nil {
-		ks.store[fqdn] = make(map[uint16]*dns.DNSKEY)
+		ks.store[fqdn] = NewKeySet()
+	}
+	ks.store[fqdn].Add(key)
+}
+
+// rrsigTime converts an RRSIG inception or expiration field to a time using
+// the serial number arithmetic from [rfc4034] 3.1.5, relative to now.
+func rrsigTime(t uint32, now time.Time) time.Time {
+	utc := now.UTC().Unix()
+	mod := (int64(t) - utc) / (1 << 31)
+	return time.Unix(int64(t)+mod*(1<<31), 0)
+}
+
+// rrsetValidity returns the period during which the RRs of the given message
+// sections and the RRSIG RRs covering them are all usable, starting from now.
+func rrsetValidity(now time.Time, sections ...[]dns.RR) (validity Validity) {
+	for _, rrs := range sections {
+		for _, rr := range rrs {
+			ttlExpiry := Validity{NotAfter: now.Add(time.Duration(rr.Header().Ttl) * time.Second)}
+			validity = validity.Intersect(ttlExpiry)
+			if rrsig, ok := rr.(*dns.RRSIG); ok {
+				validity = validity.Intersect(Validity{
+					NotBefore: rrsigTime(rrsig.Inception, now),
+					NotAfter:  rrsigTime(rrsig.Expiration, now),
+				})
+			}
+		}
 	}
-	ks.store[fqdn][key.KeyTag()] = key
+	if validity.NotAfter.IsZero() {
+		validity.NotAfter = now
+	}
+	return
 }
@@ -0,0 +1,227 @@
+package dnssec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// KeyStoreSnapshotVersion is the version of the on-disk format written by
+// KeyStore.WriteTo. Snapshots of any other version are rejected on load.
+const KeyStoreSnapshotVersion = 1
+
+type keyStoreSnapshot struct {
+	Version     int                          `json:"version"`
+	Created     time.Time                    `json:"created"`
+	Zones       []keyStoreSnapshotZone       `json:"zones"`
+	Delegations []keyStoreSnapshotDelegation `json:"delegations"`
+}
+
+type keyStoreSnapshotZone struct {
+	Zone      string    `json:"zone"`
+	Keys      []string  `json:"keys"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+type keyStoreSnapshotDelegation struct {
+	Name        string    `json:"name"`
+	SigningZone string    `json:"signing_zone"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+}
+
+// WriteTo serializes every verified zone key set and delegation in the store.
+// Trust anchors never expire and are part of the resolver configuration, so
+// they are left out of the snapshot.
+func (ks *KeyStore) WriteTo(w io.Writer) (n int64, err error) {
+	snapshot := keyStoreSnapshot{
+		Version: KeyStoreSnapshotVersion,
+		Created: time.Now().UTC(),
+	}
+
+	ks.mutex.RLock()
+	for zone, validity := range ks.zoneValidity {
+		if validity.NotAfter.IsZero() {
+			continue
+		}
+		snapshot.Zones = append(snapshot.Zones, newKeyStoreSnapshotZone(zone, ks.store[zone], validity))
+	}
+	for fqdn, signingZoneFqdn := range ks.signingZoneMap {
+		validity := ks.delegationValidity[fqdn]
+		if validity.NotAfter.IsZero() {
+			continue
+		}
+		snapshot.Delegations = append(snapshot.Delegations, keyStoreSnapshotDelegation{
+			Name:        fqdn,
+			SigningZone: signingZoneFqdn,
+			NotBefore:   validity.NotBefore,
+			NotAfter:    validity.NotAfter,
+		})
+	}
+	ks.mutex.RUnlock()
+
+	sort.Slice(snapshot.Zones, func(i, j int) bool { return snapshot.Zones[i].Zone < snapshot.Zones[j].Zone })
+	sort.Slice(snapshot.Delegations, func(i, j int) bool { return snapshot.Delegations[i].Name < snapshot.Delegations[j].Name })
+
+	data, err := json.MarshalIndent(&snapshot, "", "  ")
+	if err != nil {
+		return
+	}
+	written, err := w.Write(append(data, '\n'))
+	n = int64(written)
+	return
+}
+
+// ReadFrom merges a snapshot written by WriteTo into the store. Zones and
+// delegations that are not valid at the time of loading are skipped, as are
+// delegations to zones whose keys did not survive that check.
+func (ks *KeyStore) ReadFrom(r io.Reader) (n int64, err error) {
+	var snapshot keyStoreSnapshot
+	data, err := io.ReadAll(r)
+	n = int64(len(data))
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		err = fmt.Errorf("failed to decode key store snapshot: %w", err)
+		return
+	}
+	if snapshot.Version != KeyStoreSnapshotVersion {
+		err = fmt.Errorf("unsupported key store snapshot version %d", snapshot.Version)
+		return
+	}
+
+	now := time.Now()
+	zones := make(map[string]KeySet)
+	validities := make(map[string]Validity)
+	for _, z := range snapshot.Zones {
+		var keys KeySet
+		if keys, err = z.parse(); err != nil {
+			return
+		}
+		validity := Validity{NotBefore: z.NotBefore, NotAfter: z.NotAfter}
+		if validity.NotAfter.IsZero() || !validity.Covers(now) {
+			continue
+		}
+		zones[dns.Fqdn(z.Zone)] = keys
+		validities[dns.Fqdn(z.Zone)] = validity
+	}
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	for zone, keys := range zones {
+		ks.mergeZoneLocked(zone, keys, validities[zone])
+	}
+	for _, d := range snapshot.Delegations {
+		validity := Validity{NotBefore: d.NotBefore, NotAfter: d.NotAfter}
+		if validity.NotAfter.IsZero() || !validity.Covers(now) {
+			continue
+		}
+		fqdn, signingZoneFqdn := dns.Fqdn(d.Name), dns.Fqdn(d.SigningZone)
+		if ks.store[signingZoneFqdn] == nil {
+			continue
+		}
+		if fqdn == signingZoneFqdn && zones[fqdn] == nil {
+			continue
+		}
+		ks.signingZoneMap[fqdn] = signingZoneFqdn
+		ks.delegationValidity[fqdn] = validity
+	}
+	return
+}
+
+func (z *keyStoreSnapshotZone) parse() (keys KeySet, err error) {
+	zone := dns.Fqdn(z.Zone)
+	keys = NewKeySet()
+	for _, s := range z.Keys {
+		var rr dns.RR
+		if rr, err = dns.NewRR(s); err != nil {
+			err = fmt.Errorf("failed to parse key of zone %s in key store snapshot: %w", zone, err)
+			return
+		}
+		dnskey, ok := rr.(*dns.DNSKEY)
+		if !ok || dns.Fqdn(dnskey.Hdr.Name) != zone {
+			err = fmt.Errorf("unexpected record %q for zone %s in key store snapshot", s, zone)
+			return
+		}
+		keys.Add(dnskey)
+	}
+	return
+}
+
+func newKeyStoreSnapshotZone(zone string, keys KeySet, validity Validity) (z keyStoreSnapshotZone) {
+	z = keyStoreSnapshotZone{
+		Zone:      zone,
+		NotBefore: validity.NotBefore,
+		NotAfter:  validity.NotAfter,
+	}
+	for _, key := range keys.Keys() {
+		z.Keys = append(z.Keys, key.String())
+	}
+	sort.Strings(z.Keys)
+	return
+}
+
+// mergeZoneLocked replaces the cached keys of zone unless it is configured
+// as a trust anchor.
+func (ks *KeyStore) mergeZoneLocked(zone string, keys KeySet, validity Validity) {
+	if ks.zoneValidity[zone].NotAfter.IsZero() && ks.store[zone] != nil {
+		return
+	}
+	ks.store[zone] = NewKeySet()
+	for _, key := range keys.Keys() {
+		ks.addLocked(key)
+	}
+	ks.zoneValidity[zone] = validity
+	ks.signingZoneMap[zone] = zone
+	ks.delegationValidity[zone] = validity
+}
+
+// SaveFile atomically replaces the file at path with a snapshot of the store,
+// so a crash while saving never leaves a truncated snapshot behind.
+func (ks *KeyStore) SaveFile(path string) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err = ks.WriteTo(f); err != nil {
+		return
+	}
+	if err = f.Sync(); err != nil {
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	err = os.Rename(f.Name(), path)
+	return
+}
+
+// LoadFile merges the snapshot at path into the store. A missing file is not
+// an error, so a cold start simply begins with an empty cache.
+func (ks *KeyStore) LoadFile(path string) (err error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, err = ks.ReadFrom(f)
+	return
+}
@@ -0,0 +1,60 @@
+package dnssec_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+)
+
+func newTestKey(t *testing.T, zone string) *dns.DNSKEY {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	if _, err := key.Generate(256); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestKeyStoreSnapshot(t *testing.T) {
+	rootKey := newTestKey(t, ".")
+	comKey := newTestKey(t, "com.")
+	staleKey := newTestKey(t, "net.")
+	now := time.Now()
+	valid := dnssec.Validity{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)}
+	expired := dnssec.Validity{NotBefore: now.Add(-2 * time.Hour), NotAfter: now.Add(-time.Hour)}
+
+	ks := dnssec.NewKeyStore(dnssec.NewKeySet(rootKey))
+	ks.Add("com.", "com.", dnssec.NewKeySet(comKey), valid)
+	ks.Add("example.com.", "com.", dnssec.NewKeySet(comKey), valid)
+	ks.Add("net.", "net.", dnssec.NewKeySet(staleKey), expired)
+
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	if err := ks.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := dnssec.NewKeyStore(dnssec.NewKeySet(rootKey))
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if zone, keys := loaded.Get("example.com."); zone != "com." || keys[comKey.KeyTag()] == nil {
+		t.Errorf("expected delegation of example.com. to com. to survive, got %q %v", zone, keys)
+	}
+	if zone, keys := loaded.Get("net."); zone != "" || keys != nil {
+		t.Errorf("expected expired zone net. to be dropped, got %q %v", zone, keys)
+	}
+	if zone, keys := loaded.Get("."); zone != "." || keys[rootKey.KeyTag()] == nil {
+		t.Errorf("expected trust anchor to be kept, got %q %v", zone, keys)
+	}
+
+	if err := dnssec.NewKeyStore(nil).LoadFile(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("expected missing snapshot to be ignored, got %v", err)
+	}
+}
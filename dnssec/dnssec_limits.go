@@ -0,0 +1,41 @@
+package dnssec
+
+// Limits bounds the work spent on authenticating a single RRset, so a zone
+// publishing many keys with colliding key tags or many RRSIG RRs per RRset
+// cannot exhaust the validator, see KeyTrap (CVE-2023-50387), and the memory
+// a zone may take in the aggressive cache.
+type Limits struct {
+	// MaxKeysPerTag is how many DNSKEY RRs sharing the key tag of an RRSIG
+	// RR are tried with it.
+	MaxKeysPerTag int
+	// MaxVerifications is how many signatures are verified per RRset before
+	// giving up on it.
+	MaxVerifications int
+	// MaxAggressiveRRsets is how many NSEC, NSEC3 and wildcard RRsets of a
+	// zone are kept for synthesizing answers, see [rfc8198]. The ones
+	// expiring first are dropped beyond it.
+	MaxAggressiveRRsets int
+}
+
+// DefaultLimits are the limits used by VerifyMsgSignature, VerifyRRsets and
+// resolvers created without WithLimits.
+var DefaultLimits = Limits{
+	MaxKeysPerTag:       4,
+	MaxVerifications:    8,
+	MaxAggressiveRRsets: 1024,
+}
+
+// withDefaults returns limits with every field left at zero taken from
+// DefaultLimits.
+func (limits Limits) withDefaults() Limits {
+	if limits.MaxKeysPerTag == 0 {
+		limits.MaxKeysPerTag = DefaultLimits.MaxKeysPerTag
+	}
+	if limits.MaxVerifications == 0 {
+		limits.MaxVerifications = DefaultLimits.MaxVerifications
+	}
+	if limits.MaxAggressiveRRsets == 0 {
+		limits.MaxAggressiveRRsets = DefaultLimits.MaxAggressiveRRsets
+	}
+	return limits
+}
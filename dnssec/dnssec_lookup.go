@@ -0,0 +1,253 @@
+package dnssec
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain bounds the CNAME RRs followed within one answer.
+const maxCNAMEChain = 16
+
+// LookupRRs returns the RRs of qtype at name, following the CNAME RRs of the
+// answer, with the security status of the answer, which is Secure or wraps
+// ErrInsecure. Bogus and Indeterminate answers are returned as both status
+// and err, a *net.DNSError when the answer holds no such RRs only as err.
+func (resolver *Resolver) LookupRRs(name string, qtype uint16) (rrs []dns.RR, status SecurityStatus, err error) {
+	fqdn := dns.Fqdn(name)
+	msg, err := resolver.Resolve(fqdn, qtype)
+	if status = err; err != nil && !errors.Is(err, ErrInsecure) {
+		return
+	}
+	err = nil
+	switch msg.Rcode {
+	case dns.RcodeSuccess:
+	case dns.RcodeNameError:
+		err = &net.DNSError{Err: "no such host", Name: fqdn, IsNotFound: true}
+		return
+	default:
+		err = &net.DNSError{Err: "server misbehaving: " + dns.RcodeToString[msg.Rcode], Name: fqdn, IsTemporary: msg.Rcode == dns.RcodeServerFailure}
+		return
+	}
+	owner, rrs := followCNAMEs(msg.Answer, fqdn, qtype)
+	if len(rrs) == 0 {
+		err = &net.DNSError{Err: "no such host", Name: owner, IsNotFound: true}
+	}
+	return
+}
+
+// followCNAMEs returns the RRs of qtype at the end of the CNAME chain
+// starting at fqdn in answer.
+func followCNAMEs(answer []dns.RR, fqdn string, qtype uint16) (owner string, rrs []dns.RR) {
+	owner = fqdn
+	for i := 0; i <= maxCNAMEChain; i++ {
+		var target string
+		for _, rr := range answer {
+			hdr := rr.Header()
+			if !strings.EqualFold(hdr.Name, owner) {
+				continue
+			}
+			switch {
+			case hdr.Rrtype == qtype:
+				rrs = append(rrs, rr)
+			case hdr.Rrtype == dns.TypeCNAME:
+				target = rr.(*dns.CNAME).Target
+			}
+		}
+		if len(rrs) > 0 || target == "" {
+			return
+		}
+		owner = target
+	}
+	return
+}
+
+// LookupCNAME returns the canonical name of host at the end of its CNAME
+// chain, which is host itself if it is not an alias.
+func (resolver *Resolver) LookupCNAME(host string) (cname string, status SecurityStatus, err error) {
+	fqdn := dns.Fqdn(host)
+	msg, err := resolver.Resolve(fqdn, dns.TypeA)
+	if status = err; err != nil && !errors.Is(err, ErrInsecure) {
+		return
+	}
+	err = nil
+	if msg.Rcode == dns.RcodeNameError {
+		err = &net.DNSError{Err: "no such host", Name: fqdn, IsNotFound: true}
+		return
+	}
+	cname, _ = followCNAMEs(msg.Answer, fqdn, dns.TypeA)
+	return
+}
+
+// LookupIP returns the addresses of host for network "ip", "ip4" or "ip6",
+// querying the A and AAAA RRsets in parallel. The status is Secure only if
+// every queried RRset is.
+func (resolver *Resolver) LookupIP(network, host string) (ips []net.IP, status SecurityStatus, err error) {
+	var qtypes []uint16
+	switch network {
+	case "ip":
+		qtypes = []uint16{dns.TypeA, dns.TypeAAAA}
+	case "ip4":
+		qtypes = []uint16{dns.TypeA}
+	case "ip6":
+		qtypes = []uint16{dns.TypeAAAA}
+	default:
+		err = net.UnknownNetworkError(network)
+		return
+	}
+	type lookup struct {
+		rrs    []dns.RR
+		status SecurityStatus
+		err    error
+	}
+	lookups := make([]chan lookup, len(qtypes))
+	for i, qtype := range qtypes {
+		lookups[i] = make(chan lookup, 1)
+		go func(qtype uint16, c chan<- lookup) {
+			var l lookup
+			l.rrs, l.status, l.err = resolver.LookupRRs(host, qtype)
+			c <- l
+		}(qtype, lookups[i])
+	}
+	var notFound error
+	for _, c := range lookups {
+		l := <-c
+		switch {
+		case l.err == nil:
+		case IgnoreNotFound(l.err) == nil:
+			notFound = l.err
+		default:
+			// e.g. a Bogus AAAA RRset must not be hidden by a Secure A RRset
+			err = l.err
+		}
+		if l.status != Secure {
+			status = l.status
+		}
+		for _, rr := range l.rrs {
+			switch rr := rr.(type) {
+			case *dns.A:
+				ips = append(ips, rr.A)
+			case *dns.AAAA:
+				ips = append(ips, rr.AAAA)
+			}
+		}
+	}
+	if err != nil {
+		ips, status = nil, err
+		return
+	}
+	if len(ips) == 0 {
+		err = notFound
+	}
+	return
+}
+
+// IgnoreNotFound returns nil for the *net.DNSError of a name without the RRs
+// looked up, which the Lookup methods report as an error like package net
+// does, and err otherwise.
+func IgnoreNotFound(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil
+	}
+	return err
+}
+
+// LookupHost returns the addresses of host as strings.
+func (resolver *Resolver) LookupHost(host string) (addrs []string, status SecurityStatus, err error) {
+	ips, status, err := resolver.LookupIP("ip", host)
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+	return
+}
+
+// LookupMX returns the MX RRs of name sorted by preference.
+func (resolver *Resolver) LookupMX(name string) (mxs []*net.MX, status SecurityStatus, err error) {
+	rrs, status, err := resolver.LookupRRs(name, dns.TypeMX)
+	for _, rr := range rrs {
+		mx := rr.(*dns.MX)
+		mxs = append(mxs, &net.MX{Host: mx.Mx, Pref: mx.Preference})
+	}
+	sort.SliceStable(mxs, func(i, j int) bool {
+		return mxs[i].Pref < mxs[j].Pref
+	})
+	return
+}
+
+// LookupNS returns the NS RRs of name.
+func (resolver *Resolver) LookupNS(name string) (nss []*net.NS, status SecurityStatus, err error) {
+	rrs, status, err := resolver.LookupRRs(name, dns.TypeNS)
+	for _, rr := range rrs {
+		nss = append(nss, &net.NS{Host: rr.(*dns.NS).Ns})
+	}
+	return
+}
+
+// LookupTXT returns the TXT RRs of name, joining the strings of each RR.
+func (resolver *Resolver) LookupTXT(name string) (txts []string, status SecurityStatus, err error) {
+	rrs, status, err := resolver.LookupRRs(name, dns.TypeTXT)
+	for _, rr := range rrs {
+		txts = append(txts, strings.Join(rr.(*dns.TXT).Txt, ""))
+	}
+	return
+}
+
+// LookupSRV returns the SRV RRs of _service._proto.name, or of name if service
+// and proto are empty, ordered by priority and randomized by weight within a
+// priority as described in [rfc2782]. cname is the name the RRs were found at.
+func (resolver *Resolver) LookupSRV(service, proto, name string) (cname string, srvs []*net.SRV, status SecurityStatus, err error) {
+	target := dns.Fqdn(name)
+	if service != "" || proto != "" {
+		target = "_" + service + "._" + proto + "." + target
+	}
+	rrs, status, err := resolver.LookupRRs(target, dns.TypeSRV)
+	for _, rr := range rrs {
+		srv := rr.(*dns.SRV)
+		cname = srv.Hdr.Name
+		srvs = append(srvs, &net.SRV{Target: srv.Target, Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight})
+	}
+	sortSRV(srvs)
+	return
+}
+
+// sortSRV orders srvs by priority and then picks each next RR of a priority
+// with a probability proportional to its weight, see [rfc2782].
+func sortSRV(srvs []*net.SRV) {
+	sort.SliceStable(srvs, func(i, j int) bool {
+		return srvs[i].Priority < srvs[j].Priority
+	})
+	for start := 0; start < len(srvs); {
+		end := start + 1
+		for end < len(srvs) && srvs[end].Priority == srvs[start].Priority {
+			end++
+		}
+		// RRs of weight 0 come first, so they have a very small chance of
+		// being selected when there are others
+		group := srvs[start:end]
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Weight == 0 && group[j].Weight != 0
+		})
+		for i := range group {
+			sum := 0
+			for _, srv := range group[i:] {
+				sum += int(srv.Weight)
+			}
+			if sum == 0 {
+				break
+			}
+			n := rand.Intn(sum + 1)
+			for j, srv := range group[i:] {
+				if n -= int(srv.Weight); n <= 0 {
+					group[i], group[i+j] = group[i+j], group[i]
+					break
+				}
+			}
+		}
+		start = end
+	}
+}
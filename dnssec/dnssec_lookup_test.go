@@ -0,0 +1,81 @@
+package dnssec_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestLookup(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add(
+		"www 300 IN A 192.0.2.1",
+		"www 300 IN AAAA 2001:db8::1",
+		"alias 300 IN CNAME www.example.",
+		"example. 300 IN MX 20 backup.example.",
+		"example. 300 IN MX 10 mail.example.",
+		"example. 300 IN TXT \"v=spf1 \" \"-all\"",
+		"_imap._tcp 300 IN SRV 20 0 143 backup.example.",
+		"_imap._tcp 300 IN SRV 10 60 143 mail1.example.",
+		"_imap._tcp 300 IN SRV 10 40 143 mail2.example.",
+		"v4only 300 IN A 192.0.2.2",
+	)
+	tree.AddZone("unsigned.").Add("www 300 IN A 192.0.2.3").Unsigned = true
+	tree.AddZone("broken.").Add("www 300 IN A 192.0.2.4").Bogus = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ips, status, err := resolver.LookupIP("ip", "alias.example")
+	if err != nil || status != dnssec.Secure || len(ips) != 2 {
+		t.Errorf("expected secure A and AAAA RRs through CNAME, got %v %v %v", ips, status, err)
+	}
+	if ips, status, err = resolver.LookupIP("ip", "v4only.example."); err != nil || status != dnssec.Secure || len(ips) != 1 {
+		t.Errorf("expected secure address without AAAA RRs, got %v %v %v", ips, status, err)
+	}
+	if cname, status, err := resolver.LookupCNAME("alias.example."); err != nil || status != dnssec.Secure || cname != "www.example." {
+		t.Errorf("expected secure canonical name, got %v %v %v", cname, status, err)
+	}
+
+	mxs, status, err := resolver.LookupMX("example.")
+	if err != nil || status != dnssec.Secure || len(mxs) != 2 || mxs[0].Host != "mail.example." {
+		t.Errorf("expected MX RRs sorted by preference, got %v %v %v", mxs, status, err)
+	}
+	txts, status, err := resolver.LookupTXT("example.")
+	if err != nil || status != dnssec.Secure || len(txts) != 1 || txts[0] != "v=spf1 -all" {
+		t.Errorf("expected joined TXT strings, got %q %v %v", txts, status, err)
+	}
+	for i := 0; i < 10; i++ {
+		_, srvs, status, err := resolver.LookupSRV("imap", "tcp", "example.")
+		if err != nil || status != dnssec.Secure || len(srvs) != 3 {
+			t.Fatalf("expected secure SRV RRs, got %v %v %v", srvs, status, err)
+		}
+		if srvs[0].Priority != 10 || srvs[1].Priority != 10 || srvs[2].Target != "backup.example." {
+			t.Errorf("expected SRV RRs ordered by priority, got %v %v %v", srvs[0], srvs[1], srvs[2])
+		}
+	}
+
+	if ips, status, err = resolver.LookupIP("ip4", "www.unsigned."); err != nil || !errors.Is(status, dnssec.ErrInsecure) || len(ips) != 1 {
+		t.Errorf("expected insecure address, got %v %v %v", ips, status, err)
+	}
+	if ips, status, err = resolver.LookupIP("ip4", "www.broken."); !errors.Is(err, dnssec.ErrBogus) || !errors.Is(status, dnssec.ErrBogus) || len(ips) != 0 {
+		t.Errorf("expected bogus address to fail, got %v %v %v", ips, status, err)
+	}
+	var dnsErr *net.DNSError
+	if _, status, err = resolver.LookupIP("ip", "missing.example."); !errors.As(err, &dnsErr) || !dnsErr.IsNotFound || status != dnssec.Secure {
+		t.Errorf("expected secure not found error, got %v %v", status, err)
+	}
+	if err = dnssec.IgnoreNotFound(err); err != nil {
+		t.Errorf("expected not found error to be ignored, got %v", err)
+	}
+	if _, _, err = resolver.LookupIP("ip4", "www.broken."); dnssec.IgnoreNotFound(err) != err {
+		t.Errorf("expected bogus error to be kept, got %v", dnssec.IgnoreNotFound(err))
+	}
+}
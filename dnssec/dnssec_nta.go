@@ -0,0 +1,141 @@
+package dnssec
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// [rfc7646] 2. Negative Trust Anchors
+//
+// A Negative Trust Anchor (NTA) is a domain name for which a validating
+// resolver turns off DNSSEC validation. Data at or below that name is treated
+// as Insecure, so lookups under a zone whose DNSSEC is broken keep working
+// until its operator fixes it.
+
+// MaxNegativeTrustAnchorLifetime caps how long a negative trust anchor may
+// stay active. [rfc7646] 8. recommends that NTAs expire within a week.
+const MaxNegativeTrustAnchorLifetime = 7 * 24 * time.Hour
+
+type NegativeTrustAnchor struct {
+	Domain  string
+	Added   time.Time
+	Expires time.Time
+	Reason  string
+}
+
+// NegativeTrustAnchors is a registry of negative trust anchors which may be
+// changed while resolvers are using it. Every change and every expiry is
+// written to the audit logger.
+type NegativeTrustAnchors struct {
+	mutex   sync.RWMutex
+	anchors map[string]NegativeTrustAnchor
+	logger  *log.Logger
+}
+
+// NewNegativeTrustAnchors creates an empty registry writing its audit log to
+// logger, or to the standard logger when logger is nil.
+func NewNegativeTrustAnchors(logger *log.Logger) *NegativeTrustAnchors {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &NegativeTrustAnchors{
+		anchors: make(map[string]NegativeTrustAnchor),
+		logger:  logger,
+	}
+}
+
+// Add disables validation for domain and every name below it for lifetime.
+// Adding a domain that is already present replaces its expiry and reason.
+func (ntas *NegativeTrustAnchors) Add(domain string, lifetime time.Duration, reason string) (err error) {
+	if lifetime <= 0 || lifetime > MaxNegativeTrustAnchorLifetime {
+		err = fmt.Errorf("negative trust anchor lifetime %v is not within (0, %v]", lifetime, MaxNegativeTrustAnchorLifetime)
+		return
+	}
+	fqdn := dns.CanonicalName(domain)
+	if fqdn == "." {
+		err = fmt.Errorf("refusing to add a negative trust anchor for the root zone")
+		return
+	}
+	now := time.Now()
+	nta := NegativeTrustAnchor{
+		Domain:  fqdn,
+		Added:   now,
+		Expires: now.Add(lifetime),
+		Reason:  reason,
+	}
+	ntas.mutex.Lock()
+	ntas.anchors[fqdn] = nta
+	ntas.mutex.Unlock()
+	ntas.logger.Printf("dnssec: negative trust anchor added for %s until %s: %s", fqdn, nta.Expires.UTC().Format(time.RFC3339), reason)
+	return
+}
+
+// Remove enables validation for domain again and reports whether it had a
+// negative trust anchor.
+func (ntas *NegativeTrustAnchors) Remove(domain string) (ok bool) {
+	fqdn := dns.CanonicalName(domain)
+	ntas.mutex.Lock()
+	if _, ok = ntas.anchors[fqdn]; ok {
+		delete(ntas.anchors, fqdn)
+	}
+	ntas.mutex.Unlock()
+	if ok {
+		ntas.logger.Printf("dnssec: negative trust anchor removed for %s", fqdn)
+	}
+	return
+}
+
+// List returns the active negative trust anchors ordered by domain.
+func (ntas *NegativeTrustAnchors) List() (list []NegativeTrustAnchor) {
+	ntas.expire(time.Now())
+	ntas.mutex.RLock()
+	for _, nta := range ntas.anchors {
+		list = append(list, nta)
+	}
+	ntas.mutex.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Domain < list[j].Domain })
+	return
+}
+
+// Lookup returns the closest active negative trust anchor at or above fqdn.
+func (ntas *NegativeTrustAnchors) Lookup(fqdn string) (nta NegativeTrustAnchor, ok bool) {
+	now := time.Now()
+	name := dns.CanonicalName(fqdn)
+	ntas.mutex.RLock()
+	if len(ntas.anchors) == 0 {
+		ntas.mutex.RUnlock()
+		return
+	}
+	for {
+		if nta, ok = ntas.anchors[name]; ok || name == "." {
+			break
+		}
+		name = getParentFQDN(name)
+	}
+	ntas.mutex.RUnlock()
+	if ok && now.After(nta.Expires) {
+		ntas.expire(now)
+		return ntas.Lookup(fqdn)
+	}
+	return
+}
+
+func (ntas *NegativeTrustAnchors) expire(now time.Time) {
+	var expired []NegativeTrustAnchor
+	ntas.mutex.Lock()
+	for fqdn, nta := range ntas.anchors {
+		if now.After(nta.Expires) {
+			delete(ntas.anchors, fqdn)
+			expired = append(expired, nta)
+		}
+	}
+	ntas.mutex.Unlock()
+	for _, nta := range expired {
+		ntas.logger.Printf("dnssec: negative trust anchor expired for %s", nta.Domain)
+	}
+}
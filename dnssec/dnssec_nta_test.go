@@ -0,0 +1,61 @@
+package dnssec_test
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestNegativeTrustAnchors(t *testing.T) {
+	tree := dnstest.NewTree()
+	broken := tree.AddZone("broken.")
+	broken.Bogus = true
+	broken.Add("www 300 IN A 192.0.2.1")
+
+	var audit bytes.Buffer
+	ntas := dnssec.NewNegativeTrustAnchors(log.New(&audit, "", 0))
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+		dnssec.WithNegativeTrustAnchors(ntas),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = resolver.Resolve("www.broken.", dns.TypeA); !errors.Is(err, dnssec.ErrBogus) {
+		t.Fatalf("expected ErrBogus without negative trust anchor, got %v", err)
+	}
+
+	if err = ntas.Add("broken.", time.Hour, "signatures broken since key rollover"); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := resolver.Resolve("www.broken.", dns.TypeA)
+	if !errors.Is(err, dnssec.ErrInsecure) || msg == nil || len(msg.Answer) == 0 {
+		t.Errorf("expected insecure answer under negative trust anchor, got %v %v", err, msg)
+	}
+	if list := ntas.List(); len(list) != 1 || list[0].Domain != "broken." {
+		t.Errorf("unexpected negative trust anchors %v", list)
+	}
+
+	if !ntas.Remove("broken.") {
+		t.Error("expected negative trust anchor to be removed")
+	}
+	if _, err = resolver.Resolve("www.broken.", dns.TypeA); !errors.Is(err, dnssec.ErrBogus) {
+		t.Errorf("expected ErrBogus after removing negative trust anchor, got %v", err)
+	}
+
+	if err = ntas.Add("broken.", dnssec.MaxNegativeTrustAnchorLifetime+time.Second, ""); err == nil {
+		t.Error("expected lifetime over the maximum to be rejected")
+	}
+	if !strings.Contains(audit.String(), "added for broken.") || !strings.Contains(audit.String(), "removed for broken.") {
+		t.Errorf("missing audit log entries in %q", audit.String())
+	}
+}
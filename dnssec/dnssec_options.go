@@ -1,19 +1,45 @@
 package dnssec
 
-import "github.com/miekg/dns"
+import (
+	"context"
+	"time"
+
+	"github.com/miekg/dns"
+)
 
 type config struct {
-	trustAnchors map[uint16]*dns.DNSKEY
+	trustAnchors KeySet
 	dnsResolver  DNSResolver
+	keystore     *KeyStore
+	cacheBackend CacheBackend
+	cacheHMACKey []byte
+
+	negativeTrustAnchors *NegativeTrustAnchors
+	algorithmPolicy      *AlgorithmPolicy
+
+	refreshAhead    time.Duration
+	refreshAheadSet bool
+
+	noAggressiveNSEC bool
+
+	limits Limits
 }
 
 type DNSResolver interface {
 	Query(msg *dns.Msg) (resp *dns.Msg, err error)
 }
 
+// ContextDNSResolver is a DNSResolver whose queries can be canceled. The
+// resolver uses QueryContext when it is available to abandon the queries for
+// a chain of trust that are no longer needed, e.g. after a failure higher up.
+type ContextDNSResolver interface {
+	DNSResolver
+	QueryContext(ctx context.Context, msg *dns.Msg) (resp *dns.Msg, err error)
+}
+
 type Option func(*config)
 
-func WithTrustAnchors(keys map[uint16]*dns.DNSKEY) Option {
+func WithTrustAnchors(keys KeySet) Option {
 	return func(c *config) {
 		c.trustAnchors = keys
 	}
@@ -24,3 +50,67 @@ func WithDNSResolver(resolver DNSResolver) Option {
 		c.dnsResolver = resolver
 	}
 }
+
+// WithKeyStore makes the resolver cache verified zone keys in keystore, e.g.
+// one warmed up from a snapshot with KeyStore.LoadFile. The trust anchors are
+// added to it when the resolver is created.
+func WithKeyStore(keystore *KeyStore) Option {
+	return func(c *config) {
+		c.keystore = keystore
+	}
+}
+
+// WithCacheBackend shares verified zone keys and validated responses through
+// backend. Every value is authenticated with an HMAC using hmacKey, which must
+// be at least 16 bytes long and known only to the resolvers sharing the cache,
+// so a compromised backend cannot inject keys or responses.
+func WithCacheBackend(backend CacheBackend, hmacKey []byte) Option {
+	return func(c *config) {
+		c.cacheBackend = backend
+		c.cacheHMACKey = hmacKey
+	}
+}
+
+// WithNegativeTrustAnchors makes the resolver treat names covered by ntas as
+// Insecure, e.g. to share one registry between several resolvers. By default
+// every resolver has its own registry logging to the standard logger.
+func WithNegativeTrustAnchors(ntas *NegativeTrustAnchors) Option {
+	return func(c *config) {
+		c.negativeTrustAnchors = ntas
+	}
+}
+
+// WithAlgorithmPolicy sets which DNSKEY algorithms and DS digest types the
+// resolver accepts, instead of DefaultAlgorithmPolicy.
+func WithAlgorithmPolicy(policy *AlgorithmPolicy) Option {
+	return func(c *config) {
+		c.algorithmPolicy = policy
+	}
+}
+
+// WithRefreshAhead makes the resolver verify the keys of a zone again in the
+// background when they are used less than window before they expire, instead
+// of DefaultRefreshAhead. A window of zero disables refreshing ahead.
+func WithRefreshAhead(window time.Duration) Option {
+	return func(c *config) {
+		c.refreshAhead = window
+		c.refreshAheadSet = true
+	}
+}
+
+// WithoutAggressiveNSEC makes the resolver ask upstream for every name instead
+// of answering from validated NSEC and NSEC3 RRs it has seen, see [rfc8198].
+func WithoutAggressiveNSEC() Option {
+	return func(c *config) {
+		c.noAggressiveNSEC = true
+	}
+}
+
+// WithLimits bounds the work spent on authenticating each RRset and the
+// RRsets kept for aggressive use of the cache, instead of DefaultLimits. The
+// fields of limits left at zero are taken from DefaultLimits.
+func WithLimits(limits Limits) Option {
+	return func(c *config) {
+		c.limits = limits
+	}
+}
@@ -0,0 +1,147 @@
+package dnssec
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// AlgorithmSupport is how a validator treats a DNSKEY algorithm or DS digest
+// type, after the recommendations of [rfc8624].
+type AlgorithmSupport uint8
+
+const (
+	// Unsupported algorithms are ignored as if they were unknown. A zone that
+	// can only be authenticated with them is Insecure, see [rfc4035] 5.2.
+	Unsupported AlgorithmSupport = iota
+
+	// Deprecated algorithms are still used for validation, but only when no
+	// allowed algorithm is available.
+	Deprecated
+
+	Allowed
+)
+
+func (s AlgorithmSupport) String() string {
+	switch s {
+	case Allowed:
+		return "allowed"
+	case Deprecated:
+		return "deprecated"
+	default:
+		return "unsupported"
+	}
+}
+
+// AlgorithmPolicy lists which DNSKEY algorithms and DS digest types the
+// resolver accepts. Algorithms missing from the maps are Unsupported.
+type AlgorithmPolicy struct {
+	Algorithms  map[uint8]AlgorithmSupport
+	DigestTypes map[uint8]AlgorithmSupport
+}
+
+// DefaultAlgorithmPolicy follows the validation columns of [rfc8624] 3.1 and
+// 3.2: MUST NOT algorithms are unsupported, NOT RECOMMENDED ones deprecated.
+// GOST is unsupported as it cannot be verified by this package.
+func DefaultAlgorithmPolicy() *AlgorithmPolicy {
+	return &AlgorithmPolicy{
+		Algorithms: map[uint8]AlgorithmSupport{
+			dns.RSAMD5:           Unsupported,
+			dns.DSA:              Unsupported,
+			dns.RSASHA1:          Deprecated,
+			dns.DSANSEC3SHA1:     Unsupported,
+			dns.RSASHA1NSEC3SHA1: Deprecated,
+			dns.RSASHA256:        Allowed,
+			dns.RSASHA512:        Allowed,
+			dns.ECCGOST:          Unsupported,
+			dns.ECDSAP256SHA256:  Allowed,
+			dns.ECDSAP384SHA384:  Allowed,
+			dns.ED25519:          Allowed,
+			dns.ED448:            Allowed,
+		},
+		DigestTypes: map[uint8]AlgorithmSupport{
+			dns.SHA1:   Deprecated,
+			dns.SHA256: Allowed,
+			dns.GOST94: Unsupported,
+			dns.SHA384: Allowed,
+		},
+	}
+}
+
+func (p *AlgorithmPolicy) Algorithm(algorithm uint8) AlgorithmSupport {
+	return p.Algorithms[algorithm]
+}
+
+func (p *AlgorithmPolicy) DigestType(digestType uint8) AlgorithmSupport {
+	return p.DigestTypes[digestType]
+}
+
+// digestStrength ranks DS digest types so the strongest one present in a DS
+// RRset is preferred, as [rfc4509] 3. does for SHA-256 over SHA-1.
+func digestStrength(digestType uint8) int {
+	switch digestType {
+	case dns.SHA384:
+		return 4
+	case dns.SHA256:
+		return 3
+	case dns.GOST94:
+		return 2
+	case dns.SHA1:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// SelectDS returns the DS RRs of dsRRs that a validator should use to
+// authenticate the child zone: those with a supported algorithm and digest
+// type, restricted to the most preferred algorithm support level and digest
+// type among them, so deprecated algorithms are only used without an allowed
+// one. An empty result for a non-empty DS RRset means the child zone is
+// Insecure.
+func (p *AlgorithmPolicy) SelectDS(dsRRs []*dns.DS) (selected []*dns.DS) {
+	var usable []*dns.DS
+	var bestAlgorithm AlgorithmSupport
+	for _, ds := range dsRRs {
+		algorithm := p.Algorithm(ds.Algorithm)
+		if algorithm == Unsupported || p.DigestType(ds.DigestType) == Unsupported || digestStrength(ds.DigestType) == 0 {
+			continue
+		}
+		usable = append(usable, ds)
+		if algorithm > bestAlgorithm {
+			bestAlgorithm = algorithm
+		}
+	}
+	var (
+		best         uint8
+		bestSupport  AlgorithmSupport
+		bestStrength int
+	)
+	for _, ds := range usable {
+		if p.Algorithm(ds.Algorithm) != bestAlgorithm {
+			continue
+		}
+		support, strength := p.DigestType(ds.DigestType), digestStrength(ds.DigestType)
+		if support > bestSupport || (support == bestSupport && strength > bestStrength) {
+			best, bestSupport, bestStrength = ds.DigestType, support, strength
+		}
+	}
+	if bestSupport == Unsupported {
+		return
+	}
+	for _, ds := range usable {
+		if ds.DigestType == best && p.Algorithm(ds.Algorithm) == bestAlgorithm {
+			selected = append(selected, ds)
+		}
+	}
+	return
+}
+
+// matchDS reports whether dnskey is the key referenced by ds.
+func matchDS(dnskey *dns.DNSKEY, ds *dns.DS) bool {
+	if dnskey.Algorithm != ds.Algorithm || dnskey.KeyTag() != ds.KeyTag {
+		return false
+	}
+	dsExpect := dnskey.ToDS(ds.DigestType)
+	return dsExpect != nil && strings.EqualFold(ds.Digest, dsExpect.Digest)
+}
@@ -0,0 +1,77 @@
+package dnssec_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestAlgorithmPolicy(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("modern.").Add("www 300 IN A 192.0.2.1")
+	legacy := tree.AddZone("legacy.")
+	tree.Resign(legacy, dns.RSASHA1, dns.SHA1)
+	legacy.Add("www 300 IN A 192.0.2.2")
+	unsigned := tree.AddZone("unsigned.")
+	unsigned.Unsigned = true
+	unsigned.Add("www 300 IN A 192.0.2.3")
+
+	policy := dnssec.DefaultAlgorithmPolicy()
+	policy.Algorithms[dns.RSASHA1] = dnssec.Unsupported
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+		dnssec.WithAlgorithmPolicy(policy),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]error{
+		"www.modern.":   dnssec.Secure,
+		"www.legacy.":   dnssec.ErrInsecure,
+		"www.unsigned.": dnssec.ErrInsecure,
+	} {
+		msg, err := resolver.Resolve(name, dns.TypeA)
+		if !errors.Is(err, expected) || msg == nil || len(msg.Answer) == 0 {
+			t.Errorf("%s: expected %v with an answer, got %v %v", name, expected, err, msg)
+		}
+	}
+}
+
+func TestSelectDS(t *testing.T) {
+	ds := func(algorithm, digestType uint8) *dns.DS {
+		return &dns.DS{KeyTag: 1, Algorithm: algorithm, DigestType: digestType}
+	}
+	policy := dnssec.DefaultAlgorithmPolicy()
+	for _, c := range []struct {
+		in       []*dns.DS
+		expected []uint8
+	}{
+		{[]*dns.DS{ds(dns.ECDSAP256SHA256, dns.SHA1), ds(dns.ECDSAP256SHA256, dns.SHA256)}, []uint8{dns.SHA256}},
+		{[]*dns.DS{ds(dns.ECDSAP256SHA256, dns.SHA256), ds(dns.ECDSAP256SHA256, dns.SHA384)}, []uint8{dns.SHA384}},
+		{[]*dns.DS{ds(dns.RSASHA256, dns.SHA1)}, []uint8{dns.SHA1}},
+		{[]*dns.DS{ds(dns.RSAMD5, dns.SHA256), ds(dns.ECDSAP256SHA256, dns.GOST94)}, nil},
+		{[]*dns.DS{ds(dns.RSASHA1, dns.SHA384), ds(dns.ECDSAP256SHA256, dns.SHA256)}, []uint8{dns.SHA256}},
+	} {
+		selected := policy.SelectDS(c.in)
+		if len(selected) != len(c.expected) {
+			t.Errorf("expected digest types %v, got %v", c.expected, selected)
+			continue
+		}
+		for i := range selected {
+			if selected[i].DigestType != c.expected[i] {
+				t.Errorf("expected digest types %v, got %v", c.expected, selected)
+			}
+		}
+	}
+
+	// a deprecated algorithm is dropped alongside an allowed one
+	selected := policy.SelectDS([]*dns.DS{ds(dns.RSASHA1, dns.SHA256), ds(dns.ECDSAP256SHA256, dns.SHA256)})
+	if len(selected) != 1 || selected[0].Algorithm != dns.ECDSAP256SHA256 {
+		t.Errorf("expected only the DS RR with the allowed algorithm, got %v", selected)
+	}
+}
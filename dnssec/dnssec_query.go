@@ -0,0 +1,113 @@
+package dnssec
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// Query answers req like a validating recursive resolver, so a Resolver can
+// be stacked under anything using a DNSResolver, e.g. a cache or a server.
+// Secure answers have the AD bit set when req has the DO or AD bit set
+// ([rfc6840] 5.8), Insecure ones are returned without it and Bogus or
+// Indeterminate ones return the error instead of a message. With the CD bit
+// set req is forwarded without validation ([rfc4035] 3.2.2). The EDNS options
+// of req are passed on upstream, except for the hop-by-hop ones.
+func (resolver *Resolver) Query(req *dns.Msg) (resp *dns.Msg, err error) {
+	if len(req.Question) != 1 {
+		err = fmt.Errorf("query must have exactly one question, got %d", len(req.Question))
+		return
+	}
+	q := req.Question[0]
+	do := false
+	var options []dns.EDNS0
+	if opt := req.IsEdns0(); opt != nil {
+		do = opt.Do()
+		options = endToEndOptions(opt.Option)
+	}
+
+	var answer *dns.Msg
+	secure := false
+	if req.CheckingDisabled {
+		forward := newQuery(q.Name, q.Qtype, options)
+		forward.CheckingDisabled = true
+		if answer, err = resolver.dnsResolver.Query(forward); err != nil {
+			return
+		}
+	} else {
+		answer, err = resolver.resolve(q.Name, q.Qtype, options, nil)
+		switch {
+		case err == nil:
+			secure = true
+		case errors.Is(err, ErrInsecure):
+			err = nil
+		default:
+			return
+		}
+	}
+
+	resp = new(dns.Msg)
+	resp.SetReply(req)
+	resp.RecursionAvailable = true
+	resp.AuthenticatedData = secure && (do || req.AuthenticatedData)
+	resp.Rcode = answer.Rcode
+	resp.Answer = FilterDNSSEC(answer.Answer, q.Qtype, do)
+	resp.Ns = FilterDNSSEC(answer.Ns, q.Qtype, do)
+	for _, rr := range answer.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			resp.Extra = append(resp.Extra, rr)
+		}
+	}
+	resp.Extra = FilterDNSSEC(resp.Extra, q.Qtype, do)
+	if req.IsEdns0() != nil {
+		resp.SetEdns0(4096, do)
+	}
+	resp = resp.Copy()
+	return
+}
+
+// newQuery returns a query for the RRset of name and typ asking for DNSSEC
+// RRs, with options in its OPT RR.
+func newQuery(name string, typ uint16, options []dns.EDNS0) (msg *dns.Msg) {
+	msg = new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), typ)
+	msg.SetEdns0(4096, true)
+	if len(options) > 0 {
+		opt := msg.IsEdns0()
+		opt.Option = append(opt.Option, options...)
+	}
+	return
+}
+
+// endToEndOptions drops the EDNS options only meant for the connection they
+// were received on: cookies ([rfc7873]), TCP keepalive ([rfc7828]) and
+// padding ([rfc7830]).
+func endToEndOptions(options []dns.EDNS0) (out []dns.EDNS0) {
+	for _, option := range options {
+		switch option.Option() {
+		case dns.EDNS0COOKIE, dns.EDNS0TCPKEEPALIVE, dns.EDNS0PADDING:
+			continue
+		}
+		out = append(out, option)
+	}
+	return
+}
+
+// FilterDNSSEC removes the DNSSEC RRs of rrs which were not asked for with
+// qtype when the client did not set the DO bit, see [rfc3225] 3.
+func FilterDNSSEC(rrs []dns.RR, qtype uint16, do bool) (out []dns.RR) {
+	if do {
+		return rrs
+	}
+	for _, rr := range rrs {
+		switch typ := rr.Header().Rrtype; typ {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeDS, dns.TypeDNSKEY:
+			if typ != qtype {
+				continue
+			}
+		}
+		out = append(out, rr)
+	}
+	return
+}
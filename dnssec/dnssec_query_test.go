@@ -0,0 +1,100 @@
+package dnssec_test
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+// recordingResolver remembers the queries passed upstream.
+type recordingResolver struct {
+	tree *dnstest.Tree
+
+	mutex   sync.Mutex
+	queries []*dns.Msg
+}
+
+func (r *recordingResolver) Query(msg *dns.Msg) (*dns.Msg, error) {
+	r.mutex.Lock()
+	r.queries = append(r.queries, msg.Copy())
+	r.mutex.Unlock()
+	return r.tree.Query(msg)
+}
+
+func TestResolverQuery(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add("www 300 IN A 192.0.2.1")
+	tree.AddZone("broken.").Add("www 300 IN A 192.0.2.2").Bogus = true
+	upstream := &recordingResolver{tree: tree}
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(upstream),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a Resolver can be the upstream of another one
+	var _ dnssec.DNSResolver = resolver
+
+	query := func(name string, do, ad, cd bool) (*dns.Msg, error) {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		req.AuthenticatedData = ad
+		req.CheckingDisabled = cd
+		if do {
+			req.SetEdns0(1232, true)
+			opt := req.IsEdns0()
+			opt.Option = append(opt.Option,
+				&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.IPv4(198, 51, 100, 0)},
+				&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0102030405060708"},
+			)
+		}
+		return resolver.Query(req)
+	}
+
+	resp, err := query("www.example.", true, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.AuthenticatedData || countType(resp.Answer, dns.TypeA) != 1 || countType(resp.Answer, dns.TypeRRSIG) != 1 || resp.IsEdns0() == nil || !resp.IsEdns0().Do() {
+		t.Errorf("expected secure answer with AD bit and RRSIG RRs, got %v", resp)
+	}
+	var subnet, cookie bool
+	upstream.mutex.Lock()
+	for _, q := range upstream.queries {
+		if q.Question[0].Name != "www.example." {
+			continue
+		}
+		for _, option := range q.IsEdns0().Option {
+			subnet = subnet || option.Option() == dns.EDNS0SUBNET
+			cookie = cookie || option.Option() == dns.EDNS0COOKIE
+		}
+	}
+	upstream.mutex.Unlock()
+	if !subnet || cookie {
+		t.Errorf("expected client subnet but no cookie to be passed upstream, got %v", upstream.queries)
+	}
+
+	if resp, err = query("www.example.", false, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if resp.AuthenticatedData || countType(resp.Answer, dns.TypeRRSIG) != 0 || resp.IsEdns0() != nil {
+		t.Errorf("expected answer without AD bit and DNSSEC RRs for a client without DO bit, got %v", resp)
+	}
+	if resp, err = query("www.example.", false, true, false); err != nil || !resp.AuthenticatedData {
+		t.Errorf("expected AD bit for a client setting it, got %v %v", err, resp)
+	}
+
+	if _, err = query("www.broken.", true, false, false); !errors.Is(err, dnssec.ErrBogus) {
+		t.Errorf("expected ErrBogus, got %v", err)
+	}
+	resp, err = query("www.broken.", true, false, true)
+	if err != nil || resp.AuthenticatedData || countType(resp.Answer, dns.TypeA) != 1 {
+		t.Errorf("expected unvalidated answer with CD bit, got %v %v", err, resp)
+	}
+}
@@ -1,22 +1,49 @@
 package dnssec
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/miekg/dns"
 )
 
 type Resolver struct {
 	config
-	keystore *KeyStore
+	keystore   *KeyStore
+	responses  *responseCache
+	aggressive *aggressiveCache
+
+	refreshMutex sync.Mutex
+	refreshing   map[string]bool
 }
 
 func New(options ...Option) (resolver *Resolver, err error) {
-	resolver = new(Resolver)
+	resolver = &Resolver{refreshing: make(map[string]bool)}
 	for _, opt := range options {
 		opt(&resolver.config)
 	}
+	if resolver.algorithmPolicy == nil {
+		resolver.algorithmPolicy = DefaultAlgorithmPolicy()
+	}
+	if resolver.negativeTrustAnchors == nil {
+		resolver.negativeTrustAnchors = NewNegativeTrustAnchors(nil)
+	}
+	if !resolver.refreshAheadSet {
+		resolver.refreshAhead = DefaultRefreshAhead
+	}
+	resolver.limits = resolver.limits.withDefaults()
+	if !resolver.noAggressiveNSEC {
+		resolver.aggressive = newAggressiveCache(resolver.limits)
+	}
+	if resolver.keystore = resolver.config.keystore; resolver.keystore == nil {
+		resolver.keystore = NewKeyStore(resolver.trustAnchors)
+	} else {
+		resolver.keystore.addTrustAnchors(resolver.trustAnchors)
+	}
 	if len(resolver.trustAnchors) < 1 {
 		err = fmt.Errorf("no DNSSEC trust anchor keys provided for creating DNSSEC resolver")
 		return
@@ -25,31 +52,244 @@ func New(options ...Option) (resolver *Resolver, err error) {
 		err = fmt.Errorf("no DNS resolver provided for creating DNSSEC resolver")
 		return
 	}
-	resolver.keystore = NewKeyStore(resolver.trustAnchors)
+	if resolver.cacheBackend != nil {
+		if len(resolver.cacheHMACKey) < 16 {
+			err = fmt.Errorf("cache HMAC key must be at least 16 bytes long")
+			return
+		}
+		shared := &sealedCache{backend: resolver.cacheBackend, hmacKey: resolver.cacheHMACKey}
+		resolver.keystore.SetBackend(shared)
+		resolver.responses = &responseCache{backend: shared}
+	}
 	return
 }
 
-func (resolver *Resolver) Query(name string, typ uint16) (msg *dns.Msg, err error) {
+// NegativeTrustAnchors returns the registry of domains for which the resolver
+// skips validation and reports ErrInsecure instead.
+func (resolver *Resolver) NegativeTrustAnchors() *NegativeTrustAnchors {
+	return resolver.negativeTrustAnchors
+}
+
+// KeyStore returns the cache of verified zone keys used by the resolver, e.g.
+// to save a snapshot of it with KeyStore.SaveFile before the process exits.
+func (resolver *Resolver) KeyStore() *KeyStore {
+	return resolver.keystore
+}
+
+// Resolve queries the RRset of name and typ and validates the answer. Secure
+// answers are returned with a nil error, Insecure ones together with
+// ErrInsecure and Bogus or Indeterminate ones without a message.
+func (resolver *Resolver) Resolve(name string, typ uint16) (msg *dns.Msg, err error) {
+	return resolver.resolve(name, typ, nil, nil)
+}
+
+// resolve is Resolve sending options in the OPT RR of the upstream query and
+// recording its steps with rec, if not nil.
+func (resolver *Resolver) resolve(name string, typ uint16, options []dns.EDNS0, rec *traceRecorder) (msg *dns.Msg, err error) {
 	fqdn := dns.Fqdn(name)
-	msg = new(dns.Msg)
-	msg.SetEdns0(4096, true)
-	msg.SetQuestion(fqdn, typ)
-	if msg, err = resolver.dnsResolver.Query(msg); err != nil {
+	if nta, ok := resolver.negativeTrustAnchors.Lookup(fqdn); ok {
+		rec.negativeTrustAnchor(fqdn, nta.Domain)
+		msg = newQuery(fqdn, typ, options)
+		msg.CheckingDisabled = true
+		if msg, err = resolver.dnsResolver.Query(msg); err == nil {
+			err = ErrInsecure
+		}
 		return
 	}
-	signingZoneFQDN, signingZoneKeys, err := resolver.GetVerifiedZoneKeys(fqdn)
+	if resolver.aggressive != nil {
+		var ok bool
+		if msg, ok = resolver.aggressive.lookup(fqdn, typ); ok {
+			rec.cachedAnswer(msg, Secure, "aggressive cache")
+			return
+		}
+	}
+	if resolver.responses != nil {
+		var ok bool
+		if msg, err, ok = resolver.responses.get(fqdn, typ); ok {
+			rec.cachedAnswer(msg, err, "response cache")
+			return
+		}
+		defer func() {
+			if msg != nil {
+				resolver.responses.set(msg, err)
+			}
+		}()
+	}
+	// build the chain of trust while the answer is queried
+	type zoneKeys struct {
+		fqdn string
+		keys KeySet
+		err  error
+	}
+	chain := make(chan zoneKeys, 1)
+	go func() {
+		var z zoneKeys
+		z.fqdn, z.keys, z.err = resolver.getVerifiedZoneKeys(signerOf(fqdn, typ), rec)
+		chain <- z
+	}()
+	if msg, err = resolver.dnsResolver.Query(newQuery(fqdn, typ, options)); err != nil {
+		return
+	}
+	defer func() {
+		// never hand out a response that failed validation; ErrInsecure
+		// only comes with a message when getVerifiedZoneKeys proved the
+		// signer zone insecure
+		if err != nil && !errors.Is(err, ErrInsecure) {
+			msg = nil
+		}
+	}()
+	z := <-chain
+	signingZoneFQDN, signingZoneKeys, err := z.fqdn, z.keys, z.err
 	if err != nil {
 		return
 	}
-	if _, err = VerifyMsgSignature(msg, signingZoneFQDN, signingZoneKeys); err != nil {
+	if msg, err = resolver.verifyResponse(msg, signingZoneFQDN, signingZoneKeys, rec); err != nil {
 		return
 	}
+	if resolver.aggressive != nil {
+		resolver.aggressive.add(msg, signingZoneFQDN, signingZoneKeys)
+	}
 	return
 }
 
-func (resolver *Resolver) GetVerifiedZoneKeys(fqdn string) (signingZoneFQDN string, signingZoneKeys map[uint16]*dns.DNSKEY, err error) {
-	signingZoneFQDN, signingZoneKeys = resolver.keystore.Get(fqdn)
+// verifyResponse authenticates msg like VerifyMsgSignature and then the
+// RRsets signed by other zones, like the end of a CNAME chain leading out of
+// the zone. RRsets of the Answer section that cannot be authenticated make
+// msg Insecure if getVerifiedZoneKeys proves that they are in an insecure
+// zone and Bogus otherwise; those of the other sections are stripped. Only
+// Insecure answers are returned together with an error.
+func (resolver *Resolver) verifyResponse(msg *dns.Msg, signingZoneFQDN string, signingZoneKeys KeySet, rec *traceRecorder) (verified *dns.Msg, err error) {
+	if verified, err = verifyMsgSignature(msg, signingZoneFQDN, signingZoneKeys, resolver.limits); err != nil {
+		for _, section := range [][]dns.RR{msg.Answer, msg.Ns} {
+			for _, rrset := range SplitRRsets(section) {
+				rec.answer(rrset, signingZoneFQDN, signingZoneKeys)
+			}
+		}
+		if !errors.Is(err, ErrBogus) {
+			// the signer zone has authenticated keys, so it is not insecure
+			err = fmt.Errorf("%w: %s", ErrBogus, err.Error())
+		}
+		verified = nil
+		return
+	}
+	for i, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		out := [...]*[]dns.RR{&verified.Answer, &verified.Ns, &verified.Extra}[i]
+		authenticated := SplitRRsets(*out)
+		for _, rrset := range SplitRRsets(section) {
+			if containsRRset(authenticated, rrset) {
+				if i < 2 {
+					rec.answer(rrset, signingZoneFQDN, signingZoneKeys)
+				}
+				continue
+			}
+			result := RRsetResult{RRset: rrset, Status: ErrInsecure}
+			signer, signerKeys := signingZoneFQDN, signingZoneKeys
+			for _, rrsig := range rrset.RRSIGs {
+				if strings.EqualFold(rrsig.SignerName, signingZoneFQDN) {
+					continue
+				}
+				zone, keys, zoneErr := resolver.getVerifiedZoneKeys(rrsig.SignerName, rec)
+				if zoneErr != nil || zone != dns.CanonicalName(rrsig.SignerName) {
+					continue
+				}
+				signer, signerKeys = zone, keys
+				if result = rrset.VerifyWithLimits(zone, keys, resolver.limits); result.Status == Secure {
+					break
+				}
+			}
+			if i < 2 {
+				rec.answer(rrset, signer, signerKeys)
+			}
+			switch {
+			case result.Status == Secure:
+				*out = rrset.Append(*out, result.RRSIG)
+				continue
+			case i > 0:
+				continue
+			case errors.Is(result.Status, ErrBogus):
+				err = result.Status
+				return
+			}
+			if _, _, err = resolver.getVerifiedZoneKeys(signerOf(rrset.Name, rrset.Type), rec); errors.Is(err, ErrInsecure) {
+				// e.g. a CNAME RR pointing into an unsigned zone
+				verified = msg
+				return
+			}
+			err = fmt.Errorf("%w: no valid RRSIG for %s %s", ErrBogus, rrset.Name, dns.TypeToString[rrset.Type])
+			return
+		}
+	}
+	return
+}
+
+// signerOf returns the name whose zone signs the RRset of fqdn and typ: the DS
+// RRset of a zone apex is signed by the parent zone, see [rfc4035] 2.4.
+func signerOf(fqdn string, typ uint16) string {
+	if typ == dns.TypeDS && fqdn != "." {
+		return getParentFQDN(fqdn)
+	}
+	return fqdn
+}
+
+func containsRRset(rrsets []*RRset, rrset *RRset) bool {
+	for _, other := range rrsets {
+		if other.Type == rrset.Type && other.Class == rrset.Class && other.Name == rrset.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetVerifiedZoneKeys returns the verified keys of the zone fqdn belongs to.
+// The DNSKEY and DS RRsets of fqdn and of all its ancestors missing from the
+// keystore are queried in parallel, then verified from the top down. Queries
+// still running when the verification ends, e.g. below a zone that failed,
+// are canceled.
+func (resolver *Resolver) GetVerifiedZoneKeys(fqdn string) (signingZoneFQDN string, signingZoneKeys KeySet, err error) {
+	return resolver.getVerifiedZoneKeys(fqdn, nil)
+}
+
+// getVerifiedZoneKeys is GetVerifiedZoneKeys recording its steps with rec, if
+// not nil.
+func (resolver *Resolver) getVerifiedZoneKeys(fqdn string, rec *traceRecorder) (signingZoneFQDN string, signingZoneKeys KeySet, err error) {
+	if nta, ok := resolver.negativeTrustAnchors.Lookup(fqdn); ok {
+		rec.negativeTrustAnchor(fqdn, nta.Domain)
+		signingZoneFQDN = nta.Domain
+		err = ErrInsecure
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fetches := make(map[string]*zoneFetch)
+	for name := fqdn; name != "."; name = getParentFQDN(name) {
+		if _, keys := resolver.keystore.Get(name); keys != nil {
+			break
+		}
+		fetches[name] = resolver.fetchZone(ctx, name)
+	}
+	return resolver.verifyZoneKeys(fqdn, fetches, false, rec)
+}
+
+// verifyZoneKeys verifies the keys of the zone fqdn belongs to with the
+// answers of fetches, querying the ones missing, and records the steps with
+// rec, if not nil. With refresh set the keys of fqdn are verified again even
+// if they are in the keystore.
+func (resolver *Resolver) verifyZoneKeys(fqdn string, fetches map[string]*zoneFetch, refresh bool, rec *traceRecorder) (signingZoneFQDN string, signingZoneKeys KeySet, err error) {
+	if nta, ok := resolver.negativeTrustAnchors.Lookup(fqdn); ok {
+		rec.negativeTrustAnchor(fqdn, nta.Domain)
+		signingZoneFQDN = nta.Domain
+		err = ErrInsecure
+		return
+	}
+	if !refresh {
+		signingZoneFQDN, signingZoneKeys = resolver.keystore.Get(fqdn)
+	}
 	if signingZoneKeys != nil {
+		rec.cachedKeys(fqdn, signingZoneFQDN, signingZoneKeys)
+		resolver.refreshAheadOf(fqdn)
+		if len(signingZoneKeys) == 0 {
+			err = ErrInsecure
+		}
 		return
 	}
 	if fqdn == "." {
@@ -57,26 +297,31 @@ func (resolver *Resolver) GetVerifiedZoneKeys(fqdn string) (signingZoneFQDN stri
 		return
 	}
 	var parentZoneFqdn string
-	var parentKeys map[uint16]*dns.DNSKEY
-	if parentZoneFqdn, parentKeys, err = resolver.GetVerifiedZoneKeys(getParentFQDN(fqdn)); err != nil {
+	var parentKeys KeySet
+	if parentZoneFqdn, parentKeys, err = resolver.verifyZoneKeys(getParentFQDN(fqdn), fetches, false, rec); err != nil {
+		if errors.Is(err, ErrInsecure) {
+			// everything below an insecure zone is insecure as well
+			signingZoneFQDN = parentZoneFqdn
+		}
 		return
 	}
 
-	var dnskeyMsg, dsMsg *dns.Msg
-
-	msg := new(dns.Msg)
-	msg.SetEdns0(4096, true)
-	msg.SetQuestion(fqdn, dns.TypeDNSKEY)
-	if dnskeyMsg, err = resolver.dnsResolver.Query(msg); err != nil {
-		return
+	fetch := fetches[fqdn]
+	if fetch == nil {
+		fetch = resolver.fetchZone(context.Background(), fqdn)
 	}
-
-	msg = new(dns.Msg)
-	msg.SetEdns0(4096, true)
-	msg.SetQuestion(fqdn, dns.TypeDS)
-	if dsMsg, err = resolver.dnsResolver.Query(msg); err != nil {
+	<-fetch.done
+	if err = fetch.err; err != nil {
+		rec.status(fqdn, "", err)
 		return
 	}
+	dnskeyMsg, dsMsg := fetch.dnskeyMsg.Copy(), fetch.dsMsg.Copy()
+
+	// remember for how long the answers may be cached before the RRSIG RRs
+	// are stripped by the verification below
+	now := time.Now()
+	dsValidity := rrsetValidity(now, dsMsg.Answer, dsMsg.Ns)
+	dnskeyValidity := rrsetValidity(now, dnskeyMsg.Answer)
 
 	// [rfc4035] 5.2. Authenticating Referrals
 
@@ -97,40 +342,71 @@ func (resolver *Resolver) GetVerifiedZoneKeys(fqdn string) (signingZoneFQDN stri
 	// o  The DS RR has been authenticated using some DNSKEY RR in the
 	//    parent's apex DNSKEY RRset (see Section 5.3).
 
-	if dsMsg, err = VerifyMsgSignature(dsMsg, parentZoneFqdn, parentKeys); err != nil {
+	rec.rrsets(fqdn, dsMsg, parentZoneFqdn, parentKeys)
+	if dsMsg, err = verifyMsgSignature(dsMsg, parentZoneFqdn, parentKeys, resolver.limits); err != nil {
+		rec.status(fqdn, "", err)
 		return
 	}
 
+	if len(extractRRSet(dsMsg.Answer, fqdn, dns.TypeCNAME)) > 0 {
+		// an authenticated CNAME RR cannot be at a zone cut, see [rfc2181] 10.1
+		rec.status(fqdn, "alias, not a zone cut", nil)
+		signingZoneFQDN = parentZoneFqdn
+		signingZoneKeys = parentKeys
+		resolver.keystore.Add(fqdn, signingZoneFQDN, signingZoneKeys, dsValidity)
+		return
+	}
 	if len(dsMsg.Answer) == 0 {
-		// try to verify no answer with NSEC RR in Ns section
-		for _, rr := range dsMsg.Ns {
-			if nsec, ok := rr.(*dns.NSEC); ok {
-				if strings.EqualFold(nsec.Header().Name, fqdn) {
-					// fqdn has no zone, should use its parent zone
-					signingZoneFQDN = parentZoneFqdn
-					signingZoneKeys = parentKeys
-					resolver.keystore.Add(fqdn, signingZoneFQDN, signingZoneKeys)
-					return
-				}
-			}
+		// the NSEC or NSEC3 RRs in the Ns section prove that there is no DS
+		// RRset, either because fqdn is not a zone cut or because the child
+		// zone is unsigned
+		rec.denial(fqdn, dsMsg.Ns)
+		zoneCut, ok := deniesDS(dsMsg.Ns, fqdn, parentZoneFqdn)
+		if !ok {
+			// what no NSEC? Could be bogus
+			err = ErrBogus
+			rec.status(fqdn, "no DS RRset and no proof of its absence", err)
+			return
+		}
+		if zoneCut {
+			// proven insecure delegation, the child zone is unsigned
+			rec.status(fqdn, "insecure delegation", ErrInsecure)
+			signingZoneFQDN = fqdn
+			signingZoneKeys = NewKeySet()
+			resolver.keystore.Add(fqdn, signingZoneFQDN, signingZoneKeys, dsValidity)
+			err = ErrInsecure
+			return
 		}
-		// what no NSEC? Could be bogus
-		err = ErrBogus
+		// fqdn has no zone, should use its parent zone
+		rec.status(fqdn, "not a zone cut", nil)
+		signingZoneFQDN = parentZoneFqdn
+		signingZoneKeys = parentKeys
+		resolver.keystore.Add(fqdn, signingZoneFQDN, signingZoneKeys, dsValidity)
 		return
 	}
 
-	dsRRMap := make(map[uint16]*dns.DS)
+	var dsRRs []*dns.DS
 	for _, rr := range dsMsg.Answer {
 		if ds, ok := rr.(*dns.DS); ok {
-			dsRRMap[ds.KeyTag] = ds
+			dsRRs = append(dsRRs, ds)
 		}
 	}
 
-	dnskeyRRMap := make(map[uint16]*dns.DNSKEY)
-	for _, rr := range dnskeyMsg.Answer {
-		if dnskey, ok := rr.(*dns.DNSKEY); ok {
-			dnskeyRRMap[dnskey.KeyTag()] = dnskey
-		}
+	// [rfc4035] 5.2. If the validator does not support any of the algorithms
+	// listed in an authenticated DS RRset, then the resolver has no supported
+	// authentication path leading from the parent to the child. The resolver
+	// should treat this case as it would the case of an authenticated NSEC
+	// RRset proving that no DS RRset exists, as described above.
+
+	selected := resolver.algorithmPolicy.SelectDS(dsRRs)
+	rec.ds(fqdn, dsRRs, selected, dnskeyMsg.Answer)
+	if dsRRs = selected; len(dsRRs) == 0 {
+		signingZoneFQDN = fqdn
+		signingZoneKeys = NewKeySet()
+		resolver.keystore.Add(fqdn, signingZoneFQDN, signingZoneKeys, dsValidity)
+		err = fmt.Errorf("%w: no DS RR of %s uses a supported algorithm and digest type", ErrInsecure, fqdn)
+		rec.status(fqdn, "", err)
+		return
 	}
 
 	// o  The Algorithm and Key Tag in the DS RR match the Algorithm field
@@ -140,41 +416,112 @@ func (resolver *Resolver) GetVerifiedZoneKeys(fqdn string) (signingZoneFQDN stri
 	//    field, the resulting digest value matches the Digest field of the
 	//    DS RR.
 
-	zoneKeys := make(map[uint16]*dns.DNSKEY)
+	zoneKeys := NewKeySet()
 
-	for _, dnskey := range dnskeyRRMap {
+	for _, rr := range dnskeyMsg.Answer {
+		dnskey, ok := rr.(*dns.DNSKEY)
 		// o  The matching DNSKEY RR in the child zone has the Zone Flag bit
 		//    set.
-		if dnskey.Flags&dns.ZONE != 0 {
-			if ds := dsRRMap[dnskey.KeyTag()]; ds != nil && dnskey.Algorithm == ds.Algorithm {
-				dsExpect := dnskey.ToDS(ds.DigestType)
-				if strings.EqualFold(ds.Digest, dsExpect.Digest) {
-					zoneKeys[dnskey.KeyTag()] = dnskey
-				}
+		if !ok || dnskey.Flags&dns.ZONE == 0 {
+			continue
+		}
+		for _, ds := range dsRRs {
+			if matchDS(dnskey, ds) {
+				zoneKeys.Add(dnskey)
 			}
 		}
 	}
 
+	// [rfc4035] 5.2. If the validator does not find any DNSKEY RR matching
+	// an authenticated DS RR of a supported algorithm, the child zone is
+	// Bogus rather than unsigned.
+
+	dnskeys := dnskeyMsg.Answer
+	if zoneKeys.Len() == 0 {
+		err = fmt.Errorf("%w: no DNSKEY RR of %s matches its DS RRs", ErrBogus, fqdn)
+		rec.dnskeys(fqdn, dnskeys, nil)
+		rec.status(fqdn, "", err)
+		return
+	}
+
 	// o  The corresponding private key has signed the child zone's
 	//    apex DNSKEY RRset, and the resulting RRSIG RR authenticates the
 	//    child zone's apex DNSKEY RRset.
 
-	if dnskeyMsg, err = VerifyMsgSignature(dnskeyMsg, fqdn, zoneKeys); err != nil {
+	rec.rrsets(fqdn, dnskeyMsg, fqdn, zoneKeys)
+	if dnskeyMsg, err = verifyMsgSignature(dnskeyMsg, fqdn, zoneKeys, resolver.limits); err != nil {
+		if !errors.Is(err, ErrBogus) {
+			err = fmt.Errorf("%w: DNSKEY RRset of %s: %s", ErrBogus, fqdn, err.Error())
+		}
+		rec.dnskeys(fqdn, dnskeys, nil)
+		rec.status(fqdn, "", err)
 		return
 	}
 
 	for _, rr := range dnskeyMsg.Answer {
-		if dnskey, ok := rr.(*dns.DNSKEY); ok {
-			zoneKeys[dnskey.KeyTag()] = dnskey
+		if dnskey, ok := rr.(*dns.DNSKEY); ok && resolver.algorithmPolicy.Algorithm(dnskey.Algorithm) != Unsupported {
+			zoneKeys.Add(dnskey)
 		}
 	}
+	rec.dnskeys(fqdn, dnskeys, zoneKeys)
+	rec.status(fqdn, "", nil)
 
 	signingZoneFQDN = fqdn
 	signingZoneKeys = zoneKeys
-	resolver.keystore.Add(fqdn, signingZoneFQDN, signingZoneKeys)
+	resolver.keystore.Add(fqdn, signingZoneFQDN, signingZoneKeys, dsValidity.Intersect(dnskeyValidity))
 	return
 }
 
+// deniesDS checks whether the authenticated NSEC or NSEC3 RRs of ns from zone
+// prove that fqdn has no DS RRset, and whether fqdn may be the cut of an
+// unsigned zone.
+func deniesDS(ns []dns.RR, fqdn, zone string) (zoneCut, ok bool) {
+	for _, rr := range ns {
+		switch denial := rr.(type) {
+		case *dns.NSEC:
+			if strings.EqualFold(denial.Hdr.Name, fqdn) {
+				zoneCut = hasType(denial.TypeBitMap, dns.TypeNS) && !hasType(denial.TypeBitMap, dns.TypeSOA)
+				ok = true
+				return
+			}
+			if nsecCovers(denial, fqdn) {
+				ok = true
+				return
+			}
+		case *dns.NSEC3:
+			if denial.Match(fqdn) {
+				zoneCut = hasType(denial.TypeBitMap, dns.TypeNS) && !hasType(denial.TypeBitMap, dns.TypeSOA)
+				ok = true
+				return
+			}
+		}
+	}
+
+	// [rfc5155] 8.3. fqdn does not exist if the next closer name below its
+	// closest encloser is covered. An Opt-Out NSEC3 RR may hide an unsigned
+	// delegation though, see [rfc5155] 8.6.
+	for ce := getParentFQDN(fqdn); ; ce = getParentFQDN(ce) {
+		if matchNSEC3(ns, ce) != nil {
+			if nsec3 := coverNSEC3(ns, nextCloserName(ce, fqdn)); nsec3 != nil {
+				zoneCut, ok = nsec3.Flags&nsec3OptOut != 0, true
+			}
+			return
+		}
+		if ce == zone || ce == "." {
+			return
+		}
+	}
+}
+
+func hasType(bitmap []uint16, typ uint16) bool {
+	for _, t := range bitmap {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
 func getParentFQDN(fqdn string) string {
 	parentZoneIndex, _ := dns.NextLabel(fqdn, 0)
 	return dns.Fqdn(fqdn[parentZoneIndex:])
@@ -1,12 +1,14 @@
 package dnssec_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/miekg/dns"
 	"gopkg.in/n.v0/dnssec"
 	"gopkg.in/n.v0/dnssec/trust"
 	"gopkg.in/n.v0/doh"
+	"gopkg.in/n.v0/internal/dnstest"
 )
 
 func TestResolver(t *testing.T) {
@@ -27,9 +29,153 @@ func TestResolver(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	msg, err := resolver.Query("blog.cloudflare.com", dns.TypeA)
+	msg, err := resolver.Resolve("blog.cloudflare.com", dns.TypeA)
 	if err != nil {
 		t.Error(err)
 	}
 	t.Logf("%# v", msg)
 }
+
+func TestResolveStatus(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add("www 300 IN A 192.0.2.1")
+	tree.AddZone("bogus.").Add("www 300 IN A 192.0.2.2").Bogus = true
+	tree.AddZone("unsigned.").Add("www 300 IN A 192.0.2.3").Unsigned = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := resolver.Resolve("www.bogus.", dns.TypeA)
+	if !errors.Is(err, dnssec.ErrBogus) || msg != nil {
+		t.Errorf("expected bogus answer without a message, got %v %v", err, msg)
+	}
+
+	// the DS RRset of a zone apex is signed by the parent zone
+	msg, err = resolver.Resolve("example.", dns.TypeDS)
+	if err != nil || countType(msg.Answer, dns.TypeDS) == 0 {
+		t.Errorf("expected secure DS RRset, got %v %v", err, msg)
+	}
+	msg, err = resolver.Resolve("unsigned.", dns.TypeDS)
+	if err != nil || msg.Rcode != dns.RcodeSuccess || countType(msg.Answer, dns.TypeDS) != 0 {
+		t.Errorf("expected secure denial of the DS RRset, got %v %v", err, msg)
+	}
+}
+
+func TestResolvePartialLimits(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add("www 300 IN A 192.0.2.1")
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+		dnssec.WithLimits(dnssec.Limits{MaxAggressiveRRsets: 16}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the limits left at zero are the default ones rather than forbidding
+	// any verification
+	if msg, err := resolver.Resolve("www.example.", dns.TypeA); err != nil || countType(msg.Answer, dns.TypeA) != 1 {
+		t.Errorf("expected secure answer, got %v %v", err, msg)
+	}
+}
+
+// tamperingResolver passes queries to a tree and lets tamper change the
+// responses.
+type tamperingResolver struct {
+	tree   *dnstest.Tree
+	tamper func(q dns.Question, resp *dns.Msg)
+}
+
+func (r tamperingResolver) Query(msg *dns.Msg) (resp *dns.Msg, err error) {
+	if resp, err = r.tree.Query(msg); err == nil {
+		r.tamper(msg.Question[0], resp)
+	}
+	return
+}
+
+func TestResolveTamperedRRSIG(t *testing.T) {
+	for name, tamper := range map[string]func(rrsig *dns.RRSIG){
+		"key tag":   func(rrsig *dns.RRSIG) { rrsig.KeyTag++ },
+		"algorithm": func(rrsig *dns.RRSIG) { rrsig.Algorithm = dns.RSASHA512 },
+		// an unsigned zone cannot make the answer of a signed one insecure
+		"signer": func(rrsig *dns.RRSIG) { rrsig.SignerName = "unsigned." },
+	} {
+		tamper := tamper
+		tree := dnstest.NewTree()
+		tree.AddZone("example.").Add("www 300 IN A 192.0.2.1")
+		tree.AddZone("unsigned.").Unsigned = true
+		resolver, err := dnssec.New(
+			dnssec.WithTrustAnchors(tree.TrustAnchors()),
+			dnssec.WithDNSResolver(tamperingResolver{tree, func(q dns.Question, resp *dns.Msg) {
+				for _, rr := range resp.Answer {
+					if rrsig, ok := rr.(*dns.RRSIG); ok && q.Name == "www.example." {
+						tamper(rrsig)
+					}
+				}
+			}}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := resolver.Resolve("www.example.", dns.TypeA)
+		if !errors.Is(err, dnssec.ErrBogus) || msg != nil {
+			t.Errorf("%s: expected bogus answer without a message, got %v %v", name, err, msg)
+		}
+	}
+}
+
+func TestResolveDNSKEYMismatch(t *testing.T) {
+	for name, tamper := range map[string]func(tree *dnstest.Tree, resp *dns.Msg){
+		"no DNSKEY RR matching the DS RR": func(tree *dnstest.Tree, resp *dns.Msg) {
+			for i, rr := range resp.Answer {
+				if dnskey, ok := rr.(*dns.DNSKEY); ok && dnskey.Flags&dns.SEP != 0 {
+					// the tree serves its own DNSKEY RRs
+					dnskey = dns.Copy(dnskey).(*dns.DNSKEY)
+					dnskey.PublicKey = tree.Root.KSK.PublicKey
+					resp.Answer[i] = dnskey
+				}
+			}
+		},
+		"DNSKEY RRset only signed by an unmatched key": func(tree *dnstest.Tree, resp *dns.Msg) {
+			zsk := tree.Root.KSK
+			for _, rr := range resp.Answer {
+				if dnskey, ok := rr.(*dns.DNSKEY); ok && dnskey.Flags&dns.SEP == 0 {
+					zsk = dnskey
+				}
+			}
+			var answer []dns.RR
+			for _, rr := range resp.Answer {
+				if rrsig, ok := rr.(*dns.RRSIG); !ok || rrsig.KeyTag == zsk.KeyTag() {
+					answer = append(answer, rr)
+				}
+			}
+			resp.Answer = answer
+		},
+	} {
+		tamper := tamper
+		tree := dnstest.NewTree()
+		tree.AddZone("example.").Add("www 300 IN A 192.0.2.1")
+		resolver, err := dnssec.New(
+			dnssec.WithTrustAnchors(tree.TrustAnchors()),
+			dnssec.WithDNSResolver(tamperingResolver{tree, func(q dns.Question, resp *dns.Msg) {
+				if q.Qtype == dns.TypeDNSKEY && q.Name == "example." {
+					tamper(tree, resp)
+				}
+			}}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = resolver.GetVerifiedZoneKeys("example."); !errors.Is(err, dnssec.ErrBogus) {
+			t.Errorf("%s: expected ErrBogus, got %v", name, err)
+		}
+		msg, err := resolver.Resolve("www.example.", dns.TypeA)
+		if !errors.Is(err, dnssec.ErrBogus) || msg != nil {
+			t.Errorf("%s: expected bogus answer without a message, got %v %v", name, err, msg)
+		}
+	}
+}
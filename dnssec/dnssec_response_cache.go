@@ -0,0 +1,93 @@
+package dnssec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// responseCache keeps validated responses in a CacheBackend until the first
+// of their records or signatures expires.
+type responseCache struct {
+	backend CacheBackend
+}
+
+const (
+	responseCacheSecure byte = iota
+	responseCacheInsecure
+)
+
+func responseCacheKey(fqdn string, typ uint16) string {
+	return fmt.Sprintf("response/%s/%d", strings.ToLower(fqdn), typ)
+}
+
+func (c *responseCache) get(fqdn string, typ uint16) (msg *dns.Msg, status SecurityStatus, ok bool) {
+	data, err := c.backend.Get(responseCacheKey(fqdn, typ))
+	if err != nil || len(data) < 9 {
+		return
+	}
+	switch data[8] {
+	case responseCacheSecure:
+		status = Secure
+	case responseCacheInsecure:
+		status = ErrInsecure
+	default:
+		return
+	}
+	m := new(dns.Msg)
+	if err = m.Unpack(data[9:]); err != nil {
+		return
+	}
+	elapsed := time.Since(time.Unix(int64(binary.BigEndian.Uint64(data)), 0)) / time.Second
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			if hdr := rr.Header(); hdr.Rrtype != dns.TypeOPT {
+				if uint32(elapsed) >= hdr.Ttl {
+					// expired records are never served from the cache
+					return
+				}
+				hdr.Ttl -= uint32(elapsed)
+			}
+		}
+	}
+	msg, ok = m, true
+	return
+}
+
+func (c *responseCache) set(msg *dns.Msg, status SecurityStatus) {
+	var flag byte
+	switch {
+	case status == Secure:
+		flag = responseCacheSecure
+	case errors.Is(status, ErrInsecure):
+		flag = responseCacheInsecure
+	default:
+		return
+	}
+	if len(msg.Question) != 1 || (msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError) {
+		return
+	}
+	now := time.Now()
+	validity := rrsetValidity(now, msg.Answer, msg.Ns)
+	for _, rr := range msg.Ns {
+		// [rfc2308] 5. the TTL of a negative answer is taken from the SOA
+		if soa, ok := rr.(*dns.SOA); ok {
+			validity = validity.Intersect(Validity{NotAfter: now.Add(time.Duration(soa.Minttl) * time.Second)})
+		}
+	}
+	if !validity.NotAfter.After(now) {
+		return
+	}
+	wire, err := msg.Pack()
+	if err != nil {
+		return
+	}
+	data := make([]byte, 9, 9+len(wire))
+	binary.BigEndian.PutUint64(data, uint64(now.Unix()))
+	data[8] = flag
+	c.backend.Set(responseCacheKey(msg.Question[0].Name, msg.Question[0].Qtype), append(data, wire...), validity.NotAfter)
+}
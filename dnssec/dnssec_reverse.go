@@ -0,0 +1,80 @@
+package dnssec
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// ReverseName returns the in-addr.arpa name of an IPv4 address, see [rfc1035]
+// 3.5, or the ip6.arpa name of an IPv6 address, see [rfc3596] 2.5.
+func ReverseName(ip net.IP) (name string, err error) {
+	if ip.To16() == nil {
+		err = fmt.Errorf("invalid IP address %v", ip)
+		return
+	}
+	return dns.ReverseAddr(ip.String())
+}
+
+// LookupAddr returns the names the PTR RRs of addr point to.
+func (resolver *Resolver) LookupAddr(addr string) (names []string, status SecurityStatus, err error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		err = &net.DNSError{Err: "unrecognized address", Name: addr}
+		return
+	}
+	name, err := ReverseName(ip)
+	if err != nil {
+		return
+	}
+	rrs, status, err := resolver.LookupRRs(name, dns.TypePTR)
+	for _, rr := range rrs {
+		names = append(names, rr.(*dns.PTR).Ptr)
+	}
+	return
+}
+
+// LookupFCrDNS returns the names of addr that are forward-confirmed, i.e.
+// whose PTR RRs point to a name that has addr among its addresses. The status
+// is Secure only if the PTR RRs and the addresses of every returned name are.
+// Names whose addresses fail to resolve are not confirmed, their error is
+// only returned if no name is.
+func (resolver *Resolver) LookupFCrDNS(addr string) (names []string, status SecurityStatus, err error) {
+	ptrs, status, err := resolver.LookupAddr(addr)
+	if err != nil {
+		return
+	}
+	ip := net.ParseIP(addr)
+	network := "ip6"
+	if ip.To4() != nil {
+		network = "ip4"
+	}
+	var forwardErr error
+	for _, name := range ptrs {
+		ips, ipsStatus, ipsErr := resolver.LookupIP(network, name)
+		if ipsErr != nil {
+			forwardErr = ipsErr
+			continue
+		}
+		for _, forward := range ips {
+			if forward.Equal(ip) {
+				names = append(names, name)
+				if ipsStatus != Secure {
+					status = ipsStatus
+				}
+				break
+			}
+		}
+	}
+	if len(names) == 0 {
+		if err = forwardErr; err == nil {
+			err = &net.DNSError{Err: "no forward-confirmed name", Name: addr, IsNotFound: true}
+		}
+		if errors.Is(err, ErrBogus) || errors.Is(err, ErrIndeterminate) {
+			status = err
+		}
+	}
+	return
+}
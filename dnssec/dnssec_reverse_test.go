@@ -0,0 +1,60 @@
+package dnssec_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestLookupFCrDNS(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("arpa.")
+	tree.AddZone("2.0.192.in-addr.arpa.").Add(
+		"1 300 IN PTR mail.example.",
+		"2 300 IN PTR spoofed.example.",
+		"3 300 IN PTR www.unsigned.",
+		"4 300 IN PTR www.broken.",
+	)
+	tree.AddZone("8.b.d.0.1.0.0.2.ip6.arpa.").Add(
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0 300 IN PTR mail.example.",
+	)
+	tree.AddZone("example.").Add(
+		"mail 300 IN A 192.0.2.1",
+		"mail 300 IN AAAA 2001:db8::1",
+		"spoofed 300 IN A 192.0.2.99",
+	)
+	tree.AddZone("unsigned.").Add("www 300 IN A 192.0.2.3").Unsigned = true
+	tree.AddZone("broken.").Add("www 300 IN A 192.0.2.4").Bogus = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, err := dnssec.ReverseName(net.ParseIP("2001:db8::1")); err != nil || name != "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa." {
+		t.Errorf("unexpected ip6.arpa name %q %v", name, err)
+	}
+	for _, addr := range []string{"192.0.2.1", "2001:db8::1"} {
+		names, status, err := resolver.LookupFCrDNS(addr)
+		if err != nil || status != dnssec.Secure || len(names) != 1 || names[0] != "mail.example." {
+			t.Errorf("%s: expected Secure confirmed name, got %v %v %v", addr, names, status, err)
+		}
+	}
+	if names, status, err := resolver.LookupAddr("192.0.2.2"); err != nil || status != dnssec.Secure || len(names) != 1 {
+		t.Errorf("expected Secure PTR RRs, got %v %v %v", names, status, err)
+	}
+	if names, _, err := resolver.LookupFCrDNS("192.0.2.2"); err == nil {
+		t.Errorf("expected name with other addresses not to be confirmed, got %v", names)
+	}
+	if names, status, err := resolver.LookupFCrDNS("192.0.2.3"); err != nil || !errors.Is(status, dnssec.ErrInsecure) || len(names) != 1 {
+		t.Errorf("expected Insecure confirmed name, got %v %v %v", names, status, err)
+	}
+	if _, status, err := resolver.LookupFCrDNS("192.0.2.4"); !errors.Is(err, dnssec.ErrBogus) || !errors.Is(status, dnssec.ErrBogus) {
+		t.Errorf("expected Bogus forward lookup to fail, got %v %v", status, err)
+	}
+}
@@ -0,0 +1,167 @@
+package dnssec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// RRset is a set of RRs with the same owner name, class and type, see
+// [rfc2181] 5., together with the RRSIG RRs covering it.
+type RRset struct {
+	Name   string
+	Class  uint16
+	Type   uint16
+	RRs    []dns.RR
+	RRSIGs []*dns.RRSIG
+}
+
+// RRsetResult is the outcome of authenticating one RRset. Status is Secure
+// with the RRSIG and DNSKEY RR that authenticated the RRset, ErrInsecure when
+// no RRSIG RR of the signer covers it or the signer has no keys, or wraps
+// ErrBogus when every such RRSIG RR failed to verify or refers to no key of
+// the signer.
+type RRsetResult struct {
+	RRset  *RRset
+	Status SecurityStatus
+	RRSIG  *dns.RRSIG
+	DNSKEY *dns.DNSKEY
+}
+
+// SplitRRsets groups rrs into RRsets by canonical owner name, class and type
+// in the order they first appear, attaching every RRSIG RR to the RRset it
+// covers. OPT pseudo RRs and RRSIG RRs without an RRset are dropped.
+func SplitRRsets(rrs []dns.RR) (rrsets []*RRset) {
+	type rrsetKey struct {
+		name  string
+		class uint16
+		typ   uint16
+	}
+	index := make(map[rrsetKey]*RRset)
+	get := func(name string, class, typ uint16) *RRset {
+		key := rrsetKey{dns.CanonicalName(name), class, typ}
+		rrset := index[key]
+		if rrset == nil {
+			rrset = &RRset{Name: key.name, Class: class, Type: typ}
+			index[key] = rrset
+			rrsets = append(rrsets, rrset)
+		}
+		return rrset
+	}
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		switch x := rr.(type) {
+		case *dns.OPT:
+		case *dns.RRSIG:
+			rrset := get(hdr.Name, hdr.Class, x.TypeCovered)
+			rrset.RRSIGs = append(rrset.RRSIGs, x)
+		default:
+			rrset := get(hdr.Name, hdr.Class, hdr.Rrtype)
+			rrset.RRs = append(rrset.RRs, rr)
+		}
+	}
+	n := 0
+	for _, rrset := range rrsets {
+		if len(rrset.RRs) > 0 {
+			rrsets[n] = rrset
+			n++
+		}
+	}
+	rrsets = rrsets[:n]
+	return
+}
+
+// Verify tries every RRSIG RR of signer covering the RRset with the keys of
+// keys it refers to, until one authenticates the RRset, within DefaultLimits.
+func (rrset *RRset) Verify(signer string, keys KeySet) RRsetResult {
+	return rrset.VerifyWithLimits(signer, keys, DefaultLimits)
+}
+
+// VerifyWithLimits is like Verify but gives up on the RRset as Bogus once
+// the work allowed by limits is done.
+func (rrset *RRset) VerifyWithLimits(signer string, keys KeySet, limits Limits) (result RRsetResult) {
+	return rrset.verify(signer, keys, limits, nil)
+}
+
+// verify is VerifyWithLimits calling attempt, if not nil, for every RRSIG RR
+// of signer it tries, given by its index in RRSIGs: with each key it was
+// verified with and the outcome, or with a nil key and the reason why it was
+// not verified.
+func (rrset *RRset) verify(signer string, keys KeySet, limits Limits, attempt func(i int, dnskey *dns.DNSKEY, err error)) (result RRsetResult) {
+	if attempt == nil {
+		attempt = func(int, *dns.DNSKEY, error) {}
+	}
+	result = RRsetResult{RRset: rrset, Status: ErrInsecure}
+	var failures []string
+	verifications := 0
+	for i, rrsig := range rrset.RRSIGs {
+		if !strings.EqualFold(rrsig.SignerName, signer) {
+			continue
+		}
+		tried := 0
+		for _, dnskey := range keys[rrsig.KeyTag] {
+			if dnskey.Algorithm != rrsig.Algorithm {
+				continue
+			}
+			if tried++; tried > limits.MaxKeysPerTag {
+				failure := fmt.Sprintf("limit exceeded: more than %d keys with key tag %d", limits.MaxKeysPerTag, rrsig.KeyTag)
+				attempt(i, nil, errors.New(failure))
+				failures = append(failures, failure)
+				break
+			}
+			if verifications++; verifications > limits.MaxVerifications {
+				failure := fmt.Sprintf("limit exceeded: more than %d signatures to verify", limits.MaxVerifications)
+				attempt(i, nil, errors.New(failure))
+				result.Status = fmt.Errorf("%w: %s %s: %s", ErrBogus, rrset.Name, dns.TypeToString[rrset.Type], failure)
+				return
+			}
+			err := VerifyRRSIG(rrsig, dnskey, rrset.RRs)
+			attempt(i, dnskey, err)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("RRSIG with key tag %d failed to verify: %v", rrsig.KeyTag, err))
+				continue
+			}
+			result.Status, result.RRSIG, result.DNSKEY = Secure, rrsig, dnskey
+			return
+		}
+		if tried == 0 {
+			// [rfc4035] 5.3.1. the RRSIG RR must match a DNSKEY RR of
+			// the signer, which cannot be left out to make the RRset
+			// look unsigned
+			failure := fmt.Sprintf("no key with key tag %d and algorithm %s", rrsig.KeyTag, dns.AlgorithmToString[rrsig.Algorithm])
+			attempt(i, nil, errors.New(failure))
+			if keys.Len() > 0 {
+				failures = append(failures, failure)
+			}
+		}
+	}
+	if len(failures) > 0 {
+		result.Status = fmt.Errorf("%w: %s %s: %s", ErrBogus, rrset.Name, dns.TypeToString[rrset.Type], strings.Join(failures, "; "))
+	}
+	return
+}
+
+// Append appends the RRs of the RRset to section, followed by rrsig if it is
+// not nil.
+func (rrset *RRset) Append(section []dns.RR, rrsig *dns.RRSIG) []dns.RR {
+	section = append(section, rrset.RRs...)
+	if rrsig != nil {
+		section = append(section, rrsig)
+	}
+	return section
+}
+
+// VerifyRRsets authenticates every RRset of rrs signed by signer with keys
+// and reports the result for each of them.
+func VerifyRRsets(rrs []dns.RR, signer string, keys KeySet) []RRsetResult {
+	return verifyRRsets(rrs, signer, keys, DefaultLimits)
+}
+
+func verifyRRsets(rrs []dns.RR, signer string, keys KeySet, limits Limits) (results []RRsetResult) {
+	for _, rrset := range SplitRRsets(rrs) {
+		results = append(results, rrset.VerifyWithLimits(signer, keys, limits))
+	}
+	return
+}
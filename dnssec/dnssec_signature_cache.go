@@ -0,0 +1,125 @@
+package dnssec
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultSignatureCacheSize is the number of successful verifications
+// remembered by the signature cache unless SetSignatureCache replaces it.
+const DefaultSignatureCacheSize = 10000
+
+// SignatureCache remembers successful RRSIG verifications until the signature
+// expires, so popular RRsets are not verified again on every validation. It is
+// keyed by a hash of the RRSIG RR, the canonical RRset and the DNSKEY RR and
+// evicts the least recently used entries beyond its capacity.
+type SignatureCache struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[[sha256.Size]byte]*list.Element
+	lru      *list.List
+}
+
+type signatureCacheEntry struct {
+	key        [sha256.Size]byte
+	expiration time.Time
+}
+
+func NewSignatureCache(capacity int) *SignatureCache {
+	return &SignatureCache{
+		capacity: capacity,
+		entries:  make(map[[sha256.Size]byte]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+var (
+	signatureCache      = NewSignatureCache(DefaultSignatureCacheSize)
+	signatureCacheMutex sync.RWMutex
+)
+
+// SetSignatureCache makes VerifyRRSIG remember successful verifications in
+// cache instead of the default one. A nil cache disables caching.
+func SetSignatureCache(cache *SignatureCache) {
+	signatureCacheMutex.Lock()
+	signatureCache = cache
+	signatureCacheMutex.Unlock()
+}
+
+func currentSignatureCache() (cache *SignatureCache) {
+	signatureCacheMutex.RLock()
+	cache = signatureCache
+	signatureCacheMutex.RUnlock()
+	return
+}
+
+// Len returns the number of verifications in the cache.
+func (c *SignatureCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len()
+}
+
+// Purge drops every verification from the cache.
+func (c *SignatureCache) Purge() {
+	c.mutex.Lock()
+	c.entries = make(map[[sha256.Size]byte]*list.Element)
+	c.lru.Init()
+	c.mutex.Unlock()
+}
+
+func (c *SignatureCache) lookup(key [sha256.Size]byte, now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	if now.After(elem.Value.(*signatureCacheEntry).expiration) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return false
+	}
+	c.lru.MoveToFront(elem)
+	return true
+}
+
+func (c *SignatureCache) add(key [sha256.Size]byte, expiration time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.capacity < 1 {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*signatureCacheEntry).expiration = expiration
+		c.lru.MoveToFront(elem)
+		return
+	}
+	for c.lru.Len() >= c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*signatureCacheEntry).key)
+	}
+	c.entries[key] = c.lru.PushFront(&signatureCacheEntry{key: key, expiration: expiration})
+}
+
+// signatureCacheKey hashes the signed data, which holds the RRSIG RDATA and
+// the canonical RRset, together with the signature and the DNSKEY RR.
+func signatureCacheKey(signedData, signature []byte, dnskey *dns.DNSKEY) (key [sha256.Size]byte) {
+	h := sha256.New()
+	var n [4]byte
+	for _, data := range [][]byte{signedData, signature} {
+		binary.BigEndian.PutUint32(n[:], uint32(len(data)))
+		h.Write(n[:])
+		h.Write(data)
+	}
+	h.Write([]byte{byte(dnskey.Flags >> 8), byte(dnskey.Flags), dnskey.Protocol, dnskey.Algorithm})
+	h.Write([]byte(dnskey.PublicKey))
+	h.Sum(key[:0])
+	return
+}
@@ -0,0 +1,87 @@
+package dnssec_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+)
+
+func TestSignatureCache(t *testing.T) {
+	const algorithm = 251
+	verifications := 0
+	dnssec.RegisterAlgorithm(algorithm, dnssec.SignatureVerifierFunc(func(publicKey, signedData, signature []byte) error {
+		verifications++
+		if !bytes.Equal(signature, append(publicKey, signedData...)) {
+			return dns.ErrSig
+		}
+		return nil
+	}))
+	defer dnssec.RegisterAlgorithm(algorithm, nil)
+	cache := dnssec.NewSignatureCache(1)
+	dnssec.SetSignatureCache(cache)
+	defer dnssec.SetSignatureCache(dnssec.NewSignatureCache(dnssec.DefaultSignatureCacheSize))
+
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "example.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE,
+		Protocol:  3,
+		Algorithm: algorithm,
+		PublicKey: base64.StdEncoding.EncodeToString([]byte("key")),
+	}
+	sign := func(txt string) (rrsig *dns.RRSIG, rrset []dns.RR) {
+		rrset = []dns.RR{&dns.TXT{Hdr: dns.RR_Header{Name: "example.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{txt}}}
+		rrsig = newTestRRSIG(key, rrset)
+		data, err := dnssec.SignedData(rrsig, rrset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rrsig.Signature = base64.StdEncoding.EncodeToString(append([]byte("key"), data...))
+		return
+	}
+	hello, helloRRset := sign("hello")
+	world, worldRRset := sign("world")
+
+	for i := 0; i < 3; i++ {
+		if err := dnssec.VerifyRRSIG(hello, key, helloRRset); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if verifications != 1 || cache.Len() != 1 {
+		t.Errorf("expected one verification remembered, got %d verifications and %d entries", verifications, cache.Len())
+	}
+
+	// a failed verification is not remembered
+	forged := []dns.RR{dns.Copy(helloRRset[0])}
+	forged[0].(*dns.TXT).Txt = []string{"forged"}
+	for i := 0; i < 2; i++ {
+		if err := dnssec.VerifyRRSIG(hello, key, forged); err == nil {
+			t.Error("expected forged RRset to fail verification")
+		}
+	}
+	if verifications != 3 {
+		t.Errorf("expected failed verifications to be repeated, got %d verifications", verifications)
+	}
+
+	// the least recently used verification is evicted beyond the capacity
+	if err := dnssec.VerifyRRSIG(world, key, worldRRset); err != nil {
+		t.Fatal(err)
+	}
+	if err := dnssec.VerifyRRSIG(hello, key, helloRRset); err != nil {
+		t.Fatal(err)
+	}
+	if verifications != 5 || cache.Len() != 1 {
+		t.Errorf("expected evicted verification to be repeated, got %d verifications and %d entries", verifications, cache.Len())
+	}
+
+	// removing the verifier drops what it verified
+	dnssec.RegisterAlgorithm(algorithm, nil)
+	if cache.Len() != 0 {
+		t.Errorf("expected cache to be purged when the verifier changes, got %d entries", cache.Len())
+	}
+	if err := dnssec.VerifyRRSIG(hello, key, helloRRset); err != dns.ErrAlg {
+		t.Errorf("expected ErrAlg after removing the verifier, got %v", err)
+	}
+}
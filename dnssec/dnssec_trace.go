@@ -0,0 +1,444 @@
+package dnssec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Trace is a report of how the resolver authenticated an answer, from the
+// closest trust anchor down to the zone of the queried name, like `drill -S`
+// prints. It renders as text with String and as JSON with encoding/json.
+type Trace struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Source is where the answer came from: "upstream", "response cache"
+	// or "aggressive cache".
+	Source string `json:"source"`
+	// Zones are the names whose keys the resolver looked up, in the order
+	// it authenticated them, including the zones of CNAME targets. Names
+	// whose keys were in the keystore are not walked any further.
+	Zones []ZoneTrace `json:"zones"`
+	// Answer are the RRsets of the response, checked with the keys of the
+	// zone that signed them.
+	Answer []RRsetTrace `json:"answer,omitempty"`
+}
+
+// ZoneTrace is the verification of the delegation to one name.
+type ZoneTrace struct {
+	Name        string `json:"name"`
+	TrustAnchor bool   `json:"trust_anchor,omitempty"`
+	// Cached is set if the keys were taken from the keystore.
+	Cached bool `json:"cached,omitempty"`
+	// DS are the DS RRs of the parent zone and the keys they match.
+	DS []DSTrace `json:"ds,omitempty"`
+	// Denial are the NSEC or NSEC3 RRs proving there is no DS RRset.
+	Denial []string `json:"denial,omitempty"`
+	// DNSKEYs are the keys at the name.
+	DNSKEYs []KeyTrace `json:"dnskeys,omitempty"`
+	// RRsets are the DS or denial RRsets signed by the parent zone and the
+	// DNSKEY RRset signed by the name.
+	RRsets []RRsetTrace `json:"rrsets,omitempty"`
+	Status string       `json:"status"`
+	Note   string       `json:"note,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// DSTrace is a DS RR compared with the digests of the DNSKEY RRs of the
+// child zone.
+type DSTrace struct {
+	KeyTag     uint16 `json:"key_tag"`
+	Algorithm  string `json:"algorithm"`
+	DigestType string `json:"digest_type"`
+	Digest     string `json:"digest"`
+	// Supported is unset for DS RRs ignored by the AlgorithmPolicy.
+	Supported bool `json:"supported"`
+	// Matched is set if a DNSKEY RR with the Zone flag has the digest.
+	Matched bool `json:"matched"`
+}
+
+// KeyTrace is a DNSKEY RR.
+type KeyTrace struct {
+	KeyTag    uint16 `json:"key_tag"`
+	Algorithm string `json:"algorithm"`
+	Flags     uint16 `json:"flags"`
+	// Secure is set for keys the zone keys are made of.
+	Secure bool `json:"secure"`
+}
+
+// RRsetTrace is the verification of the RRSIG RRs of an RRset. Answers from
+// the caches have no signatures, they were verified when cached.
+type RRsetTrace struct {
+	Name       string           `json:"name"`
+	Type       string           `json:"type"`
+	Status     string           `json:"status"`
+	Error      string           `json:"error,omitempty"`
+	Signatures []SignatureTrace `json:"signatures,omitempty"`
+}
+
+// SignatureTrace is an RRSIG RR tried with the keys of its key tag.
+type SignatureTrace struct {
+	KeyTag     uint16    `json:"key_tag"`
+	Algorithm  string    `json:"algorithm"`
+	SignerName string    `json:"signer_name"`
+	Inception  time.Time `json:"inception"`
+	Expiration time.Time `json:"expiration"`
+	// Keys is how many keys with the key tag and algorithm were tried.
+	Keys  int    `json:"keys"`
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// StatusString names the security status of err as in [rfc4035] 4.3.
+func StatusString(err error) string {
+	switch {
+	case err == nil:
+		return "secure"
+	case errors.Is(err, ErrInsecure):
+		return "insecure"
+	case errors.Is(err, ErrBogus):
+		return "bogus"
+	default:
+		return "indeterminate"
+	}
+}
+
+// Trace resolves name and typ like Resolve, recording each DNSKEY, DS, RRSIG,
+// NSEC and NSEC3 RR the resolver checks on the way, as well as the keys and
+// answers it takes from its caches. The status of the trace is that of the
+// answer, which err is.
+func (resolver *Resolver) Trace(name string, typ uint16) (trace *Trace, err error) {
+	fqdn := dns.CanonicalName(name)
+	rec := &traceRecorder{
+		resolver: resolver,
+		trace:    &Trace{Name: fqdn, Type: dns.TypeToString[typ], Source: "upstream"},
+	}
+	_, err = resolver.resolve(fqdn, typ, nil, rec)
+	trace = rec.close()
+	trace.Status = StatusString(err)
+	if err != nil {
+		trace.Error = err.Error()
+	}
+	return
+}
+
+// traceRecorder collects the steps of a resolution into a Trace. Its methods
+// do nothing on a nil recorder, so the resolver calls them unconditionally.
+type traceRecorder struct {
+	resolver *Resolver
+	mutex    sync.Mutex
+	trace    *Trace
+	closed   bool
+}
+
+// close returns the trace, ignoring the steps of chain fetches still
+// running, e.g. after the upstream query failed.
+func (rec *traceRecorder) close() *Trace {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	rec.closed = true
+	return rec.trace
+}
+
+// record calls f with the trace entry of fqdn, which is created unless
+// existing is set.
+func (rec *traceRecorder) record(fqdn string, existing bool, f func(z *ZoneTrace)) {
+	if rec == nil {
+		return
+	}
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	if rec.closed {
+		return
+	}
+	fqdn = dns.CanonicalName(fqdn)
+	for i := range rec.trace.Zones {
+		if rec.trace.Zones[i].Name == fqdn {
+			if !existing {
+				f(&rec.trace.Zones[i])
+			}
+			return
+		}
+	}
+	rec.trace.Zones = append(rec.trace.Zones, ZoneTrace{Name: fqdn})
+	f(&rec.trace.Zones[len(rec.trace.Zones)-1])
+}
+
+func (rec *traceRecorder) status(fqdn, note string, status SecurityStatus) {
+	rec.record(fqdn, false, func(z *ZoneTrace) {
+		z.Status, z.Note = StatusString(status), note
+		if status != nil {
+			z.Error = status.Error()
+		}
+	})
+}
+
+func (rec *traceRecorder) negativeTrustAnchor(fqdn, domain string) {
+	rec.status(fqdn, "negative trust anchor "+domain, ErrInsecure)
+}
+
+// cachedKeys records the keys of zone found in the keystore for fqdn, only
+// the first time fqdn is looked up.
+func (rec *traceRecorder) cachedKeys(fqdn, zone string, keys KeySet) {
+	rec.record(fqdn, true, func(z *ZoneTrace) {
+		z.Status = StatusString(Secure)
+		switch {
+		case len(keys) == 0:
+			z.Status, z.Note = StatusString(ErrInsecure), "in insecure zone "+zone
+		case zone != dns.CanonicalName(fqdn):
+			z.Note = "in zone " + zone
+		}
+		z.TrustAnchor = zone == dns.CanonicalName(fqdn) && rec.resolver.trustAnchorsOf(z.Name).Len() > 0
+		z.Cached = !z.TrustAnchor
+		if zone == dns.CanonicalName(fqdn) {
+			for _, key := range keys.Keys() {
+				z.DNSKEYs = append(z.DNSKEYs, newKeyTrace(key, true))
+			}
+		}
+	})
+}
+
+// rrsets records the verification of the RRsets of msg by signer, before
+// the resolver does it.
+func (rec *traceRecorder) rrsets(fqdn string, msg *dns.Msg, signer string, keys KeySet) {
+	rec.record(fqdn, false, func(z *ZoneTrace) {
+		for _, section := range [][]dns.RR{msg.Answer, msg.Ns} {
+			for _, rrset := range SplitRRsets(section) {
+				z.RRsets = append(z.RRsets, rec.resolver.traceRRset(rrset, signer, keys))
+			}
+		}
+	})
+}
+
+func (rec *traceRecorder) denial(fqdn string, ns []dns.RR) {
+	rec.record(fqdn, false, func(z *ZoneTrace) {
+		for _, rr := range ns {
+			switch rr.(type) {
+			case *dns.NSEC, *dns.NSEC3:
+				z.Denial = append(z.Denial, rr.String())
+			}
+		}
+	})
+}
+
+// ds records the DS RRs of fqdn, which of them the AlgorithmPolicy selected
+// and whether they match one of the DNSKEY RRs.
+func (rec *traceRecorder) ds(fqdn string, dsRRs, selected []*dns.DS, dnskeys []dns.RR) {
+	rec.record(fqdn, false, func(z *ZoneTrace) {
+		for _, ds := range dsRRs {
+			t := DSTrace{
+				KeyTag:     ds.KeyTag,
+				Algorithm:  dns.AlgorithmToString[ds.Algorithm],
+				DigestType: dns.HashToString[ds.DigestType],
+				Digest:     ds.Digest,
+			}
+			for _, s := range selected {
+				t.Supported = t.Supported || s == ds
+			}
+			for _, rr := range dnskeys {
+				if dnskey, ok := rr.(*dns.DNSKEY); ok && dnskey.Flags&dns.ZONE != 0 && matchDS(dnskey, ds) {
+					t.Matched = true
+				}
+			}
+			z.DS = append(z.DS, t)
+		}
+	})
+}
+
+// dnskeys records the DNSKEY RRs of fqdn, those in zoneKeys as secure.
+func (rec *traceRecorder) dnskeys(fqdn string, dnskeys []dns.RR, zoneKeys KeySet) {
+	rec.record(fqdn, false, func(z *ZoneTrace) {
+		for _, rr := range dnskeys {
+			dnskey, ok := rr.(*dns.DNSKEY)
+			if !ok {
+				continue
+			}
+			secure := false
+			for _, key := range zoneKeys[dnskey.KeyTag()] {
+				secure = secure || dns.IsDuplicate(key, dnskey)
+			}
+			z.DNSKEYs = append(z.DNSKEYs, newKeyTrace(dnskey, secure))
+		}
+	})
+}
+
+// answer records the verification of an RRset of the response by signer.
+func (rec *traceRecorder) answer(rrset *RRset, signer string, keys KeySet) {
+	if rec == nil {
+		return
+	}
+	t := rec.resolver.traceRRset(rrset, signer, keys)
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	if !rec.closed {
+		rec.trace.Answer = append(rec.trace.Answer, t)
+	}
+}
+
+// cachedAnswer records an answer taken from source with its cached status.
+func (rec *traceRecorder) cachedAnswer(msg *dns.Msg, status SecurityStatus, source string) {
+	if rec == nil {
+		return
+	}
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	if rec.closed {
+		return
+	}
+	rec.trace.Source = source
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns} {
+		for _, rrset := range SplitRRsets(section) {
+			t := RRsetTrace{Name: rrset.Name, Type: dns.TypeToString[rrset.Type], Status: StatusString(status)}
+			if status != nil {
+				t.Error = status.Error()
+			}
+			rec.trace.Answer = append(rec.trace.Answer, t)
+		}
+	}
+}
+
+// trustAnchorsOf returns the trust anchor keys of zone.
+func (resolver *Resolver) trustAnchorsOf(zone string) (keys KeySet) {
+	keys = NewKeySet()
+	for _, key := range resolver.trustAnchors.Keys() {
+		if dns.CanonicalName(key.Hdr.Name) == zone {
+			keys.Add(key)
+		}
+	}
+	return
+}
+
+// traceRRset verifies rrset like the resolver does, within its limits, and
+// reports the outcome of each RRSIG RR and the status of the RRset. RRSIG RRs
+// left after one authenticated the RRset or the limits were exceeded are not
+// verified.
+func (resolver *Resolver) traceRRset(rrset *RRset, signer string, keys KeySet) (t RRsetTrace) {
+	t = RRsetTrace{Name: rrset.Name, Type: dns.TypeToString[rrset.Type]}
+	now := time.Now()
+	for _, rrsig := range rrset.RRSIGs {
+		s := SignatureTrace{
+			KeyTag:     rrsig.KeyTag,
+			Algorithm:  dns.AlgorithmToString[rrsig.Algorithm],
+			SignerName: rrsig.SignerName,
+			Inception:  rrsigTime(rrsig.Inception, now).UTC(),
+			Expiration: rrsigTime(rrsig.Expiration, now).UTC(),
+			Error:      "not verified",
+		}
+		if !strings.EqualFold(rrsig.SignerName, signer) {
+			s.Error = "signer is not " + signer
+		}
+		t.Signatures = append(t.Signatures, s)
+	}
+	status := rrset.verify(signer, keys, resolver.limits, func(i int, dnskey *dns.DNSKEY, err error) {
+		s := &t.Signatures[i]
+		if dnskey != nil {
+			s.Keys++
+		}
+		switch {
+		case s.Valid:
+		case err == nil:
+			s.Valid, s.Error = true, ""
+		default:
+			s.Error = err.Error()
+		}
+	}).Status
+	t.Status = StatusString(status)
+	if status != nil {
+		t.Error = status.Error()
+	}
+	return
+}
+
+func newKeyTrace(dnskey *dns.DNSKEY, secure bool) KeyTrace {
+	return KeyTrace{
+		KeyTag:    dnskey.KeyTag(),
+		Algorithm: dns.AlgorithmToString[dnskey.Algorithm],
+		Flags:     dnskey.Flags,
+		Secure:    secure,
+	}
+}
+
+// String renders the trace as indented text, one line per zone, RR and
+// signature.
+func (trace *Trace) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s: %s", trace.Name, trace.Type, trace.Status)
+	if trace.Error != "" {
+		fmt.Fprintf(&b, " (%s)", trace.Error)
+	}
+	if trace.Source != "" {
+		fmt.Fprintf(&b, " from %s", trace.Source)
+	}
+	b.WriteString("\n")
+	for _, z := range trace.Zones {
+		fmt.Fprintf(&b, "%s: %s", z.Name, z.Status)
+		if z.TrustAnchor {
+			b.WriteString(", trust anchor")
+		}
+		if z.Cached {
+			b.WriteString(", cached")
+		}
+		if z.Note != "" {
+			fmt.Fprintf(&b, ", %s", z.Note)
+		}
+		if z.Error != "" {
+			fmt.Fprintf(&b, " (%s)", z.Error)
+		}
+		b.WriteString("\n")
+		for _, ds := range z.DS {
+			fmt.Fprintf(&b, "  DS %d %s %s", ds.KeyTag, ds.Algorithm, ds.DigestType)
+			switch {
+			case !ds.Supported:
+				b.WriteString(" unsupported")
+			case ds.Matched:
+				b.WriteString(" matches DNSKEY")
+			default:
+				b.WriteString(" matches no DNSKEY")
+			}
+			b.WriteString("\n")
+		}
+		for _, denial := range z.Denial {
+			fmt.Fprintf(&b, "  %s\n", denial)
+		}
+		for _, key := range z.DNSKEYs {
+			fmt.Fprintf(&b, "  DNSKEY %d %s flags %d", key.KeyTag, key.Algorithm, key.Flags)
+			if key.Secure {
+				b.WriteString(" secure")
+			}
+			b.WriteString("\n")
+		}
+		for _, rrset := range z.RRsets {
+			rrset.write(&b, "  ")
+		}
+	}
+	if len(trace.Answer) > 0 {
+		b.WriteString("answer:\n")
+		for _, rrset := range trace.Answer {
+			rrset.write(&b, "  ")
+		}
+	}
+	return b.String()
+}
+
+func (t RRsetTrace) write(b *strings.Builder, indent string) {
+	fmt.Fprintf(b, "%s%s %s: %s", indent, t.Name, t.Type, t.Status)
+	if t.Error != "" {
+		fmt.Fprintf(b, " (%s)", t.Error)
+	}
+	b.WriteString("\n")
+	for _, s := range t.Signatures {
+		fmt.Fprintf(b, "%s  RRSIG %d %s by %s valid %s to %s: ", indent, s.KeyTag, s.Algorithm, s.SignerName,
+			s.Inception.Format(time.RFC3339), s.Expiration.Format(time.RFC3339))
+		if s.Valid {
+			b.WriteString("verified\n")
+		} else {
+			fmt.Fprintf(b, "%s\n", s.Error)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package dnssec
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestTraceRRsetLimits(t *testing.T) {
+	key, sign := testSigner(t, "example.")
+	signed := sign(&dns.TXT{
+		Hdr: dns.RR_Header{Name: "example.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+		Txt: []string{"hello"},
+	})
+	rrset := SplitRRsets(signed)[0]
+	forged := *rrset.RRSIGs[0]
+	forged.Signature = base64.StdEncoding.EncodeToString(make([]byte, 64))
+	rrset.RRSIGs = nil
+	for i := 0; i < 10; i++ {
+		rrset.RRSIGs = append(rrset.RRSIGs, &forged)
+	}
+
+	resolver := &Resolver{config: config{limits: Limits{MaxKeysPerTag: 4, MaxVerifications: 3}}}
+	trace := resolver.traceRRset(rrset, "example.", NewKeySet(key))
+	if trace.Status != "bogus" || !strings.Contains(trace.Error, "limit exceeded") {
+		t.Errorf("expected bogus RRset beyond the limits, got %s (%s)", trace.Status, trace.Error)
+	}
+	keys := 0
+	for i, s := range trace.Signatures {
+		keys += s.Keys
+		switch {
+		case i < 3 && (s.Keys != 1 || s.Valid || s.Error == ""):
+			t.Errorf("%d: expected failed verification, got %+v", i, s)
+		case i == 3 && !strings.HasPrefix(s.Error, "limit exceeded"):
+			t.Errorf("%d: expected limit exceeded, got %+v", i, s)
+		case i > 3 && s.Error != "not verified":
+			t.Errorf("%d: expected signature not to be verified, got %+v", i, s)
+		}
+	}
+	if keys != 3 {
+		t.Errorf("expected 3 verifications, got %d", keys)
+	}
+}
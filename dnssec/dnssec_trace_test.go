@@ -0,0 +1,77 @@
+package dnssec_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestTrace(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add(
+		"www 300 IN A 192.0.2.1",
+		"alias 300 IN CNAME www.cdn.",
+	)
+	tree.AddZone("cdn.").Add("www 300 IN A 192.0.2.4")
+	tree.AddZone("unsigned.").Add("www 300 IN A 192.0.2.2").Unsigned = true
+	tree.AddZone("broken.").Add("www 300 IN A 192.0.2.3").Bogus = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trace, err := resolver.Trace("www.example.", dns.TypeA)
+	if err != nil || trace.Status != "secure" {
+		t.Fatalf("expected secure trace, got %v\n%s", err, trace)
+	}
+	if len(trace.Zones) != 3 || !trace.Zones[0].TrustAnchor || trace.Zones[1].Name != "example." || trace.Zones[2].Note != "not a zone cut" {
+		t.Errorf("unexpected zones\n%s", trace)
+	}
+	if ds := trace.Zones[1].DS; len(ds) == 0 || !ds[0].Matched || !ds[0].Supported {
+		t.Errorf("expected DS RR matching a DNSKEY RR\n%s", trace)
+	}
+	if len(trace.Answer) != 1 || len(trace.Answer[0].Signatures) == 0 || !trace.Answer[0].Signatures[0].Valid {
+		t.Errorf("expected verified answer\n%s", trace)
+	}
+	data, err := json.Marshal(trace)
+	if err != nil || !strings.Contains(string(data), `"trust_anchor":true`) {
+		t.Errorf("unexpected JSON %s %v", data, err)
+	}
+
+	// the keys are taken from the keystore the second time
+	if trace, err = resolver.Trace("www.example.", dns.TypeA); err != nil || len(trace.Zones) != 1 || !trace.Zones[0].Cached || trace.Zones[0].Note != "in zone example." {
+		t.Errorf("expected cached keys, got %v\n%s", err, trace)
+	}
+	// the end of a CNAME chain is verified with the keys of its own zone
+	trace, err = resolver.Trace("alias.example.", dns.TypeA)
+	if err != nil || len(trace.Answer) != 2 || trace.Answer[1].Status != "secure" || trace.Answer[1].Signatures[0].SignerName != "cdn." {
+		t.Errorf("expected answer verified with the keys of cdn., got %v\n%s", err, trace)
+	}
+	if z := trace.Zones[len(trace.Zones)-1]; z.Name != "cdn." || z.Cached {
+		t.Errorf("expected the keys of cdn. to be verified, got %v\n%s", err, trace)
+	}
+	if _, err = resolver.Resolve("a.example.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	if trace, err = resolver.Trace("aa.example.", dns.TypeA); err != nil || trace.Source != "aggressive cache" || len(trace.Answer) == 0 {
+		t.Errorf("expected answer synthesized from NSEC RRs, got %v\n%s", err, trace)
+	}
+
+	if trace, err = resolver.Trace("www.unsigned.", dns.TypeA); !errors.Is(err, dnssec.ErrInsecure) || trace.Zones[len(trace.Zones)-1].Note != "insecure delegation" {
+		t.Errorf("expected insecure delegation, got %v\n%s", err, trace)
+	}
+	if trace, err = resolver.Trace("www.broken.", dns.TypeA); !errors.Is(err, dnssec.ErrBogus) || trace.Status != "bogus" {
+		t.Fatalf("expected bogus trace, got %v\n%s", err, trace)
+	}
+	if text := trace.String(); !strings.Contains(text, "broken.: bogus") || !strings.Contains(text, "RRSIG") {
+		t.Errorf("expected text to show the failed signature\n%s", text)
+	}
+}
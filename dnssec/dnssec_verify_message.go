@@ -2,6 +2,8 @@ package dnssec
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/miekg/dns"
 )
@@ -41,83 +43,76 @@ var (
 	ErrIndeterminate SecurityStatus = errors.New("indeterminated security status, DNSSEC info not availiable due to network error")
 )
 
-func VerifyMsgSignature(msgToVerify *dns.Msg, expectedSignerFqdn string, trustedSignerKeys map[uint16]*dns.DNSKEY) (signedMsg *dns.Msg, err error) {
+// VerifyMsgSignature authenticates the RRsets of every section of msgToVerify
+// signed by expectedSignerFqdn with trustedSignerKeys. The returned message
+// only holds the authenticated RRsets with the RRSIG RRs that authenticated
+// them, so unsigned or forged data such as glue and delegation NS RRsets is
+// stripped. The security status is determined by the Answer section, or the
+// Ns section for negative answers, which is Bogus if any of its RRsets is or if
+// none of them is authenticated by trustedSignerKeys.
+func VerifyMsgSignature(msgToVerify *dns.Msg, expectedSignerFqdn string, trustedSignerKeys KeySet) (signedMsg *dns.Msg, err error) {
+	return verifyMsgSignature(msgToVerify, expectedSignerFqdn, trustedSignerKeys, DefaultLimits)
+}
+
+func verifyMsgSignature(msgToVerify *dns.Msg, expectedSignerFqdn string, trustedSignerKeys KeySet, limits Limits) (signedMsg *dns.Msg, err error) {
 	// [rfc4035] 5.3. Authenticating an RRset with an RRSIG RR
 	// 5.3.1. Checking the RRSIG RR Validity
 
-	var (
-		rrset       []dns.RR
-		rrsigs      = make(map[uint16]*dns.RRSIG)
-		rrsetSigned = make(map[uint16][]dns.RR)
-		msg         = &dns.Msg{
-			MsgHdr:   msgToVerify.MsgHdr,
-			Compress: msgToVerify.Compress,
-			Question: msgToVerify.Question,
-			Extra:    msgToVerify.Extra,
-		}
-	)
-
-	if len(msgToVerify.Answer) > 0 {
-		rrset = msgToVerify.Answer
-	} else {
-		rrset = msgToVerify.Ns
-	}
-
-	for _, rr := range rrset {
-		if rrsig, ok := rr.(*dns.RRSIG); ok {
-			rrsigs[rrsig.KeyTag] = rrsig
-		}
+	msg := &dns.Msg{
+		MsgHdr:   msgToVerify.MsgHdr,
+		Compress: msgToVerify.Compress,
+		Question: msgToVerify.Question,
 	}
-
-	if len(rrsigs) == 0 {
-		err = ErrBogus
-		return
+	primary := 0
+	if len(msgToVerify.Answer) == 0 {
+		primary = 1
 	}
-
+	signed := false
 	err = ErrInsecure
 
-	for keytag, rrsig := range rrsigs {
-		if len(rrsetSigned[rrsig.TypeCovered]) > 0 {
-			continue
-		}
-		if dnskey, ok := trustedSignerKeys[keytag]; ok {
-			// A security-aware resolver can use an RRSIG RR to authenticate an
-			// RRset if all of the following conditions hold:
-
-			// o  The RRSIG RR and the RRset MUST have the same owner name and
-			//    the same class.
-
-			subrrset := extractRRSet(rrset, rrsig.TypeCovered)
-			if len(subrrset) == 0 {
-				continue
+	for i, section := range [][]dns.RR{msgToVerify.Answer, msgToVerify.Ns, msgToVerify.Extra} {
+		out := [...]*[]dns.RR{&msg.Answer, &msg.Ns, &msg.Extra}[i]
+		for _, result := range verifyRRsets(section, expectedSignerFqdn, trustedSignerKeys, limits) {
+			if i == primary && len(result.RRset.RRSIGs) > 0 {
+				signed = true
 			}
-
-			if err = rrsig.Verify(dnskey, subrrset); err != nil {
-				return
-			} else {
-				rrsetSigned[rrsig.TypeCovered] = subrrset
-				err = Secure
+			switch {
+			case result.Status == Secure:
+				*out = result.RRset.Append(*out, result.RRSIG)
+				if i == primary && err == ErrInsecure {
+					err = Secure
+				}
+			case i == primary && errors.Is(result.Status, ErrBogus):
+				// forged data in the other sections is only stripped
+				err = result.Status
 			}
 		}
 	}
+	if errors.Is(err, ErrBogus) {
+		return
+	}
 
-	if err == Secure && len(rrsetSigned) > 0 {
-		for _, rrset := range rrsetSigned {
-			if len(msgToVerify.Answer) > 0 {
-				msg.Answer = append(msg.Answer, rrset...)
-			} else {
-				msg.Ns = append(msg.Ns, rrset...)
-			}
+	if !signed {
+		err = ErrBogus
+		return
+	}
+	if err == ErrInsecure && trustedSignerKeys.Len() > 0 {
+		// the primary RRsets are signed but none by a key of the signer
+		err = fmt.Errorf("%w: no RRset of the response is authenticated by a key of %s", ErrBogus, expectedSignerFqdn)
+		return
+	}
+	if err == Secure {
+		if opt := msgToVerify.IsEdns0(); opt != nil {
+			msg.Extra = append(msg.Extra, opt)
 		}
 		signedMsg = msg
 	}
-
 	return
 }
 
-func extractRRSet(in []dns.RR, t uint16) (out []dns.RR) {
+func extractRRSet(in []dns.RR, name string, t uint16) (out []dns.RR) {
 	for _, rr := range in {
-		if rr.Header().Rrtype == t {
+		if rr.Header().Rrtype == t && strings.EqualFold(rr.Header().Name, name) {
 			out = append(out, rr)
 		}
 	}
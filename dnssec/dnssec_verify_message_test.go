@@ -0,0 +1,214 @@
+package dnssec_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestVerifyMsgSections(t *testing.T) {
+	tree := dnstest.NewTree()
+	example := tree.AddZone("example.").Add(
+		"www 300 IN A 192.0.2.1",
+		"mail 300 IN A 192.0.2.2",
+	)
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, keys, err := resolver.GetVerifiedZoneKeys("example.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := func(name string) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.SetQuestion(name, dns.TypeA)
+		msg.SetEdns0(4096, true)
+		resp, err := tree.Query(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// signed additional data is kept, unsigned glue and delegation NS RRs
+	// are stripped
+	msg := query("www.example.")
+	msg.Extra = append(msg.Extra, query("mail.example.").Answer...)
+	msg.Extra = append(msg.Extra, &dns.A{
+		Hdr: dns.RR_Header{Name: "glue.example.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP("192.0.2.66"),
+	})
+	msg.Ns = append(msg.Ns, &dns.NS{
+		Hdr: dns.RR_Header{Name: "example.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
+		Ns:  "ns.attacker.",
+	})
+	signed, err := dnssec.VerifyMsgSignature(msg, example.Name, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countType(signed.Answer, dns.TypeA) != 1 || countType(signed.Answer, dns.TypeRRSIG) != 1 {
+		t.Errorf("expected authenticated answer with its RRSIG, got %v", signed.Answer)
+	}
+	if countType(signed.Extra, dns.TypeA) != 1 || countType(signed.Extra, dns.TypeOPT) != 1 {
+		t.Errorf("expected signed additional A RR and OPT RR only, got %v", signed.Extra)
+	}
+	if len(signed.Ns) != 0 {
+		t.Errorf("expected unsigned NS RRs to be stripped, got %v", signed.Ns)
+	}
+
+	// a forged RR added to a signed additional RRset only strips that RRset
+	msg = query("www.example.")
+	extra := query("mail.example.").Answer
+	forged := dns.Copy(extra[0]).(*dns.A)
+	forged.A = net.ParseIP("192.0.2.66")
+	msg.Extra = append(extra, forged)
+	if signed, err = dnssec.VerifyMsgSignature(msg, example.Name, keys); err != nil {
+		t.Fatal(err)
+	}
+	if countType(signed.Answer, dns.TypeA) != 1 || countType(signed.Extra, dns.TypeA) != 0 {
+		t.Errorf("expected forged additional RRset to be stripped, got %v", signed)
+	}
+
+	// a forged RR in the answer makes the message bogus
+	msg = query("www.example.")
+	forged = dns.Copy(msg.Answer[0]).(*dns.A)
+	forged.A = net.ParseIP("192.0.2.66")
+	msg.Answer = append(msg.Answer, forged)
+	if _, err = dnssec.VerifyMsgSignature(msg, example.Name, keys); !errors.Is(err, dnssec.ErrBogus) {
+		t.Errorf("expected ErrBogus for forged answer RR, got %v", err)
+	}
+
+	// an answer only signed by another zone is not insecure
+	msg = query("www.example.")
+	for _, rr := range msg.Answer {
+		if rrsig, ok := rr.(*dns.RRSIG); ok {
+			rrsig.SignerName = "attacker."
+		}
+	}
+	if _, err = dnssec.VerifyMsgSignature(msg, example.Name, keys); !errors.Is(err, dnssec.ErrBogus) {
+		t.Errorf("expected ErrBogus for answer signed by another zone, got %v", err)
+	}
+}
+
+func TestVerifyRRsets(t *testing.T) {
+	tree := dnstest.NewTree()
+	example := tree.AddZone("example.").Add(
+		"www 300 IN A 192.0.2.1",
+		"www 300 IN TXT \"hello\"",
+		"mail 300 IN A 192.0.2.2",
+	)
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, keys, err := resolver.GetVerifiedZoneKeys("example.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rrs []dns.RR
+	for _, q := range []struct {
+		name  string
+		qtype uint16
+	}{{"www.example.", dns.TypeA}, {"WWW.example.", dns.TypeTXT}, {"mail.example.", dns.TypeA}} {
+		msg := new(dns.Msg)
+		msg.SetQuestion(q.name, q.qtype)
+		msg.SetEdns0(4096, true)
+		resp, err := tree.Query(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rrs = append(rrs, resp.Answer...)
+	}
+	// a second RRSIG RR with an unknown key tag does not prevent the valid
+	// one from authenticating the RRset
+	for _, rr := range rrs {
+		if rrsig, ok := rr.(*dns.RRSIG); ok && rrsig.TypeCovered == dns.TypeTXT {
+			other := dns.Copy(rrsig).(*dns.RRSIG)
+			other.KeyTag++
+			rrs = append(rrs, other)
+			break
+		}
+	}
+	forged := dns.Copy(rrs[len(rrs)-3]).(*dns.A)
+	forged.A = net.ParseIP("192.0.2.66")
+	rrs = append(rrs, forged, &dns.A{
+		Hdr: dns.RR_Header{Name: "glue.example.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP("192.0.2.3"),
+	})
+
+	results := dnssec.VerifyRRsets(rrs, example.Name, keys)
+	if len(results) != 4 {
+		t.Fatalf("expected 4 RRsets, got %d", len(results))
+	}
+	for i, tc := range []struct {
+		name   string
+		qtype  uint16
+		status error
+	}{
+		{"www.example.", dns.TypeA, nil},
+		{"www.example.", dns.TypeTXT, nil},
+		{"mail.example.", dns.TypeA, dnssec.ErrBogus},
+		{"glue.example.", dns.TypeA, dnssec.ErrInsecure},
+	} {
+		result := results[i]
+		if result.RRset.Name != tc.name || result.RRset.Type != tc.qtype {
+			t.Errorf("%d: expected RRset %s %s, got %s %s", i, tc.name, dns.TypeToString[tc.qtype], result.RRset.Name, dns.TypeToString[result.RRset.Type])
+		}
+		if !errors.Is(result.Status, tc.status) || (tc.status == nil) != (result.Status == nil) {
+			t.Errorf("%s %s: expected %v, got %v", tc.name, dns.TypeToString[tc.qtype], tc.status, result.Status)
+		}
+		if (result.Status == nil) != (result.RRSIG != nil && result.DNSKEY != nil) {
+			t.Errorf("%s %s: unexpected RRSIG %v and DNSKEY %v", tc.name, dns.TypeToString[tc.qtype], result.RRSIG, result.DNSKEY)
+		}
+	}
+
+	// an RRSIG RR of the signer referring to none of its keys is bogus
+	rrset := results[0].RRset
+	rrsig := dns.Copy(rrset.RRSIGs[0]).(*dns.RRSIG)
+	rrsig.KeyTag++
+	rrset.RRSIGs = []*dns.RRSIG{rrsig}
+	if status := rrset.Verify(example.Name, keys).Status; !errors.Is(status, dnssec.ErrBogus) {
+		t.Errorf("expected ErrBogus for RRSIG RR with unknown key tag, got %v", status)
+	}
+}
+
+func TestVerifyCNAMEChain(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add(
+		"www 300 IN CNAME www.cdn.",
+		"legacy 300 IN CNAME www.unsigned.",
+	)
+	tree.AddZone("cdn.").Add("www 300 IN A 192.0.2.1")
+	tree.AddZone("unsigned.").Add("www 300 IN A 192.0.2.2").Unsigned = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := resolver.Resolve("www.example.", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countType(msg.Answer, dns.TypeCNAME) != 1 || countType(msg.Answer, dns.TypeA) != 1 {
+		t.Errorf("expected authenticated CNAME chain into another zone, got %v", msg.Answer)
+	}
+
+	msg, err = resolver.Resolve("legacy.example.", dns.TypeA)
+	if !errors.Is(err, dnssec.ErrInsecure) || msg == nil || countType(msg.Answer, dns.TypeA) != 1 {
+		t.Errorf("expected insecure answer for CNAME into unsigned zone, got %v %v", err, msg)
+	}
+}
@@ -0,0 +1,120 @@
+package mailkey
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/dnssec/dane"
+)
+
+// Finder looks up the keys of email addresses through a validating
+// dnssec.Resolver. Keys are only returned from Secure answers, as anything
+// else could be substituted by an attacker.
+type Finder struct {
+	resolver *dnssec.Resolver
+}
+
+func New(resolver *dnssec.Resolver) (finder *Finder, err error) {
+	finder = &Finder{resolver: resolver}
+	if resolver == nil {
+		err = fmt.Errorf("no DNSSEC resolver provided for creating mail key finder")
+		return
+	}
+	return
+}
+
+// lookup returns the RRs of qtype at name if they are Secure. The error of a
+// name without them is a *net.DNSError.
+func (finder *Finder) lookup(name string, qtype uint16) (rrs []dns.RR, err error) {
+	rrs, status, err := finder.resolver.LookupRRs(name, qtype)
+	if err == nil && status != dnssec.Secure {
+		err = status
+	}
+	if err != nil {
+		rrs = nil
+		err = fmt.Errorf("failed to look up %s records at %s: %w", dns.TypeToString[qtype], name, err)
+	}
+	return
+}
+
+// LookupOpenPGPKey returns the OpenPGP transferable public keys of email
+// published in OPENPGPKEY records, see [rfc7929]. Records that do not parse
+// are skipped, but an error is returned if none does. Whether a key has a
+// user ID for email is left to the caller.
+func (finder *Finder) LookupOpenPGPKey(email string) (entities openpgp.EntityList, err error) {
+	name, err := OpenPGPKeyName(email)
+	if err != nil {
+		return
+	}
+	rrs, err := finder.lookup(name, dns.TypeOPENPGPKEY)
+	if err != nil {
+		return
+	}
+	for _, rr := range rrs {
+		data, decodeErr := base64.StdEncoding.DecodeString(rr.(*dns.OPENPGPKEY).PublicKey)
+		if decodeErr != nil {
+			err = decodeErr
+			continue
+		}
+		keyring, readErr := openpgp.ReadKeyRing(bytes.NewReader(data))
+		if readErr != nil {
+			err = readErr
+			continue
+		}
+		entities = append(entities, keyring...)
+	}
+	if len(entities) > 0 {
+		err = nil
+	} else if err != nil {
+		err = fmt.Errorf("no valid OpenPGP key for %s: %w", email, err)
+	}
+	return
+}
+
+// LookupSMIMEA returns the SMIMEA records of email, see [rfc8162], together
+// with the certificates of the records holding a full certificate. Records
+// holding a public key or a digest can be matched against certificates
+// obtained otherwise, e.g. from a signed message, with MatchSMIMEA.
+func (finder *Finder) LookupSMIMEA(email string) (records []*dns.SMIMEA, certs []*x509.Certificate, err error) {
+	name, err := SMIMEAName(email)
+	if err != nil {
+		return
+	}
+	rrs, err := finder.lookup(name, dns.TypeSMIMEA)
+	if err != nil {
+		return
+	}
+	for _, rr := range rrs {
+		smimea := rr.(*dns.SMIMEA)
+		records = append(records, smimea)
+		if smimea.Selector != dane.SelectorCert || smimea.MatchingType != dane.MatchingFull {
+			continue
+		}
+		data, decodeErr := hex.DecodeString(smimea.Certificate)
+		if decodeErr != nil {
+			continue
+		}
+		if cert, parseErr := x509.ParseCertificate(data); parseErr == nil {
+			certs = append(certs, cert)
+		}
+	}
+	return
+}
+
+// MatchSMIMEA reports whether cert matches the certificate association data
+// of smimea, which are those of TLSA records, see [rfc8162] 2.
+func MatchSMIMEA(smimea *dns.SMIMEA, cert *x509.Certificate) bool {
+	return dane.Match(&dns.TLSA{
+		Hdr:          smimea.Hdr,
+		Usage:        smimea.Usage,
+		Selector:     smimea.Selector,
+		MatchingType: smimea.MatchingType,
+		Certificate:  smimea.Certificate,
+	}, cert)
+}
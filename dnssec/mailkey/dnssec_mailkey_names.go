@@ -0,0 +1,49 @@
+// Package mailkey discovers the OpenPGP keys and S/MIME certificates of email
+// addresses in DNSSEC validated zones as described in [rfc7929] and
+// [rfc8162].
+package mailkey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/idna"
+)
+
+// OpenPGPKeyName returns the owner name of the OPENPGPKEY records of email,
+// see [rfc7929] 3.
+func OpenPGPKeyName(email string) (name string, err error) {
+	return ownerName(email, "_openpgpkey")
+}
+
+// SMIMEAName returns the owner name of the SMIMEA records of email, see
+// [rfc8162] 3.
+func SMIMEAName(email string) (name string, err error) {
+	return ownerName(email, "_smimecert")
+}
+
+// ownerName hashes the local part of email with SHA2-256, truncated to 28
+// octets, below the label service of its domain in A-labels ([rfc5890]). The
+// local part is used as is, without any canonicalization.
+func ownerName(email, service string) (name string, err error) {
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 || at == len(email)-1 {
+		err = fmt.Errorf("invalid email address %q", email)
+		return
+	}
+	localPart, domain := email[:at], email[at+1:]
+	if domain, err = idna.Lookup.ToASCII(domain); err != nil {
+		err = fmt.Errorf("invalid domain in email address %q: %w", email, err)
+		return
+	}
+	if _, ok := dns.IsDomainName(domain); !ok {
+		err = fmt.Errorf("invalid domain in email address %q", email)
+		return
+	}
+	sum := sha256.Sum256([]byte(localPart))
+	name = hex.EncodeToString(sum[:28]) + "." + service + "." + dns.Fqdn(domain)
+	return
+}
@@ -0,0 +1,123 @@
+package mailkey_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/dnssec/mailkey"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestOwnerNames(t *testing.T) {
+	// [rfc7929] 3.
+	name, err := mailkey.OpenPGPKeyName("hugh@example.com")
+	if err != nil || name != "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._openpgpkey.example.com." {
+		t.Errorf("unexpected OPENPGPKEY owner name %q %v", name, err)
+	}
+	if name, err = mailkey.SMIMEAName("hugh@example.com"); err != nil || name != "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert.example.com." {
+		t.Errorf("unexpected SMIMEA owner name %q %v", name, err)
+	}
+	// internationalized domain names are converted to A-labels
+	if name, err = mailkey.OpenPGPKeyName("hugh@Bücher.example"); err != nil || name != "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._openpgpkey.xn--bcher-kva.example." {
+		t.Errorf("unexpected OPENPGPKEY owner name %q %v", name, err)
+	}
+	if _, err = mailkey.SMIMEAName("example.com"); err == nil {
+		t.Error("expected address without local part to fail")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	entity, err := openpgp.NewEntity("Alice", "", "alice@example.", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var key bytes.Buffer
+	if err = entity.Serialize(&key); err != nil {
+		t.Fatal(err)
+	}
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: "Alice"},
+		EmailAddresses: []string{"alice@example."},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pgpName, _ := mailkey.OpenPGPKeyName("alice@example.")
+	smimeaName, _ := mailkey.SMIMEAName("alice@example.")
+	insecureName, _ := mailkey.OpenPGPKeyName("alice@unsigned.")
+	hdr := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: 300}
+	}
+	smimea := &dns.SMIMEA{Hdr: hdr(smimeaName, dns.TypeSMIMEA), Usage: 3, Certificate: hex.EncodeToString(der)}
+	digest := &dns.SMIMEA{Hdr: hdr(smimeaName, dns.TypeSMIMEA), Usage: 3, Selector: 1, MatchingType: 1}
+	if err = digest.Sign(3, 1, 1, cert); err != nil {
+		t.Fatal(err)
+	}
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").AddRR(
+		&dns.OPENPGPKEY{Hdr: hdr(pgpName, dns.TypeOPENPGPKEY), PublicKey: base64.StdEncoding.EncodeToString(key.Bytes())},
+		smimea,
+		digest,
+	)
+	tree.AddZone("unsigned.").AddRR(
+		&dns.OPENPGPKEY{Hdr: hdr(insecureName, dns.TypeOPENPGPKEY), PublicKey: base64.StdEncoding.EncodeToString(key.Bytes())},
+	).Unsigned = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finder, err := mailkey.New(resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entities, err := finder.LookupOpenPGPKey("alice@example.")
+	if err != nil || len(entities) != 1 || !bytes.Equal(entities[0].PrimaryKey.Fingerprint, entity.PrimaryKey.Fingerprint) {
+		t.Errorf("expected published OpenPGP key, got %v %v", entities, err)
+	}
+	if _, err = finder.LookupOpenPGPKey("alice@unsigned."); !errors.Is(err, dnssec.ErrInsecure) {
+		t.Errorf("expected Insecure key to be refused, got %v", err)
+	}
+	if _, err = finder.LookupOpenPGPKey("bob@example."); err == nil {
+		t.Error("expected missing key to fail")
+	}
+
+	records, certs, err := finder.LookupSMIMEA("alice@example.")
+	if err != nil || len(records) != 2 || len(certs) != 1 || !certs[0].Equal(cert) {
+		t.Fatalf("expected SMIMEA records with certificate, got %v %v %v", records, certs, err)
+	}
+	for _, record := range records {
+		if !mailkey.MatchSMIMEA(record, cert) {
+			t.Errorf("expected %v to match certificate", record)
+		}
+	}
+}
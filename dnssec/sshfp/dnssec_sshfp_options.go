@@ -0,0 +1,42 @@
+package sshfp
+
+import (
+	"golang.org/x/crypto/ssh"
+)
+
+// Policy decides about host keys without Secure SSHFP records of their
+// algorithm, e.g. of hosts in Insecure zones.
+type Policy int
+
+const (
+	// PolicyReject rejects the host key.
+	PolicyReject Policy = iota
+	// PolicyFallback passes the host key to the callback set with
+	// WithFallback, e.g. one checking a known_hosts file.
+	PolicyFallback
+	// PolicyMatchInsecure accepts the host key if Insecure SSHFP records
+	// match it, which only protects against passive attackers.
+	PolicyMatchInsecure
+)
+
+type config struct {
+	policy   Policy
+	fallback ssh.HostKeyCallback
+}
+
+type Option func(*config)
+
+// WithPolicy sets how to check host keys without Secure SSHFP records. The
+// default is PolicyReject.
+func WithPolicy(policy Policy) Option {
+	return func(c *config) {
+		c.policy = policy
+	}
+}
+
+// WithFallback sets the callback for PolicyFallback.
+func WithFallback(callback ssh.HostKeyCallback) Option {
+	return func(c *config) {
+		c.fallback = callback
+	}
+}
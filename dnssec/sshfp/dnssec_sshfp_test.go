@@ -0,0 +1,102 @@
+package sshfp_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/dnssec/sshfp"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func sshfpRR(owner string, key ssh.PublicKey) string {
+	sum := sha256.Sum256(key.Marshal())
+	return fmt.Sprintf("%s 300 IN SSHFP 4 2 %s", owner, hex.EncodeToString(sum[:]))
+}
+
+func TestVerifier(t *testing.T) {
+	key, other := newHostKey(t), newHostKey(t)
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add(
+		"host 300 IN A 192.0.2.1",
+		sshfpRR("host", key),
+		"plain 300 IN A 192.0.2.2",
+		"rsa 300 IN SSHFP 1 2 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	)
+	tree.AddZone("unsigned.").Add(sshfpRR("host", key)).Unsigned = true
+	tree.AddZone("broken.").Add(sshfpRR("host", key)).Bogus = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict, err := sshfp.New(resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insecure, err := sshfp.New(resolver, sshfp.WithPolicy(sshfp.PolicyMatchInsecure))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fallbacks := 0
+	fallback, err := sshfp.New(resolver, sshfp.WithPolicy(sshfp.PolicyFallback), sshfp.WithFallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		fallbacks++
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sshfp.New(resolver, sshfp.WithPolicy(sshfp.PolicyFallback)); err == nil {
+		t.Error("expected error for PolicyFallback without callback")
+	}
+
+	remote := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}
+	for _, tc := range []struct {
+		hostname string
+		key      ssh.PublicKey
+		verifier *sshfp.Verifier
+		err      error
+	}{
+		{"host.example:22", key, strict, nil},
+		{"host.example.", key, strict, nil},
+		{"host.example:22", other, strict, sshfp.ErrMismatch},
+		{"host.example:22", other, fallback, sshfp.ErrMismatch},
+		{"plain.example:22", key, strict, sshfp.ErrNoSSHFP},
+		{"rsa.example:22", key, strict, sshfp.ErrNoSSHFP},
+		{"192.0.2.1:22", key, strict, sshfp.ErrNoSSHFP},
+		{"host.unsigned:22", key, strict, sshfp.ErrNoSSHFP},
+		{"host.unsigned:22", key, insecure, nil},
+		{"host.unsigned:22", other, insecure, sshfp.ErrMismatch},
+		{"host.broken:22", key, insecure, dnssec.ErrBogus},
+		{"host.broken:22", key, fallback, dnssec.ErrBogus},
+	} {
+		err := tc.verifier.HostKeyCallback()(tc.hostname, remote, tc.key)
+		if !errors.Is(err, tc.err) || (tc.err == nil) != (err == nil) {
+			t.Errorf("%s: expected %v, got %v", tc.hostname, tc.err, err)
+		}
+	}
+	if err = fallback.Verify("host.unsigned:22", remote, key); err != nil || fallbacks != 1 {
+		t.Errorf("expected fallback callback for insecure zone, got %v after %d calls", err, fallbacks)
+	}
+}
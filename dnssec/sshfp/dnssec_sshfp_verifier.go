@@ -0,0 +1,156 @@
+// Package sshfp checks SSH host keys against SSHFP records from DNSSEC
+// validated zones as described in [rfc4255] and [rfc6594].
+package sshfp
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/n.v0/dnssec"
+)
+
+// SSHFP algorithm numbers of [rfc4255], [rfc6594] and [rfc7479] and
+// fingerprint types of [rfc4255] and [rfc6594].
+const (
+	AlgorithmRSA     uint8 = 1
+	AlgorithmDSA     uint8 = 2
+	AlgorithmECDSA   uint8 = 3
+	AlgorithmEd25519 uint8 = 4
+
+	FingerprintSHA1   uint8 = 1
+	FingerprintSHA256 uint8 = 2
+)
+
+var (
+	// ErrNoSSHFP is returned for host keys without usable SSHFP records
+	// when the policy does not accept them otherwise.
+	ErrNoSSHFP = errors.New("no usable SSHFP records for host key")
+	// ErrMismatch is returned when the SSHFP records of the host key
+	// algorithm do not match the host key.
+	ErrMismatch = errors.New("SSHFP records do not match host key")
+)
+
+// Verifier checks host keys against the SSHFP records of the host, looked up
+// through a validating dnssec.Resolver.
+type Verifier struct {
+	config
+	resolver *dnssec.Resolver
+}
+
+func New(resolver *dnssec.Resolver, options ...Option) (verifier *Verifier, err error) {
+	verifier = &Verifier{resolver: resolver}
+	for _, opt := range options {
+		opt(&verifier.config)
+	}
+	if resolver == nil {
+		err = fmt.Errorf("no DNSSEC resolver provided for creating SSHFP verifier")
+		return
+	}
+	if verifier.policy == PolicyFallback && verifier.fallback == nil {
+		err = fmt.Errorf("no fallback host key callback provided for PolicyFallback")
+		return
+	}
+	return
+}
+
+// HostKeyCallback returns the Verify method as an ssh.HostKeyCallback.
+func (verifier *Verifier) HostKeyCallback() ssh.HostKeyCallback {
+	return verifier.Verify
+}
+
+// Verify accepts key if a Secure SSHFP record of its algorithm at hostname,
+// which may carry a port, matches it. Secure records of the algorithm that
+// all differ reject the key, without any the policy decides. Bogus and
+// Indeterminate answers always reject it.
+func (verifier *Verifier) Verify(hostname string, remote net.Addr, key ssh.PublicKey) (err error) {
+	host := hostname
+	if h, _, splitErr := net.SplitHostPort(hostname); splitErr == nil {
+		host = h
+	}
+	var (
+		records []*dns.SSHFP
+		status  dnssec.SecurityStatus = dnssec.ErrInsecure
+	)
+	if net.ParseIP(host) == nil {
+		if records, status, err = verifier.LookupSSHFP(host); err != nil {
+			return
+		}
+	}
+	algorithm := Algorithm(key)
+	var usable []*dns.SSHFP
+	for _, sshfp := range records {
+		if sshfp.Algorithm == algorithm && (sshfp.Type == FingerprintSHA1 || sshfp.Type == FingerprintSHA256) {
+			usable = append(usable, sshfp)
+		}
+	}
+	if len(usable) > 0 && (status == dnssec.Secure || verifier.policy == PolicyMatchInsecure) {
+		for _, sshfp := range usable {
+			if Match(sshfp, key) {
+				return
+			}
+		}
+		err = fmt.Errorf("%w of %s", ErrMismatch, host)
+		return
+	}
+	if verifier.policy == PolicyFallback {
+		return verifier.fallback(hostname, remote, key)
+	}
+	err = fmt.Errorf("%w of %s", ErrNoSSHFP, host)
+	return
+}
+
+// LookupSSHFP returns the SSHFP records of host with their security status.
+// No records at all are not an error.
+func (verifier *Verifier) LookupSSHFP(host string) (records []*dns.SSHFP, status dnssec.SecurityStatus, err error) {
+	rrs, status, err := verifier.resolver.LookupRRs(host, dns.TypeSSHFP)
+	if err = dnssec.IgnoreNotFound(err); err != nil {
+		return
+	}
+	for _, rr := range rrs {
+		records = append(records, rr.(*dns.SSHFP))
+	}
+	return
+}
+
+// Algorithm returns the SSHFP algorithm number of key, or 0 if there is none.
+func Algorithm(key ssh.PublicKey) uint8 {
+	switch typ := key.Type(); {
+	case typ == ssh.KeyAlgoRSA:
+		return AlgorithmRSA
+	case typ == ssh.KeyAlgoDSA:
+		return AlgorithmDSA
+	case strings.HasPrefix(typ, "ecdsa-sha2-"):
+		return AlgorithmECDSA
+	case typ == ssh.KeyAlgoED25519:
+		return AlgorithmEd25519
+	}
+	return 0
+}
+
+// Match reports whether sshfp is a fingerprint of key.
+func Match(sshfp *dns.SSHFP, key ssh.PublicKey) bool {
+	if sshfp.Algorithm != Algorithm(key) {
+		return false
+	}
+	var fingerprint []byte
+	switch sshfp.Type {
+	case FingerprintSHA1:
+		sum := sha1.Sum(key.Marshal())
+		fingerprint = sum[:]
+	case FingerprintSHA256:
+		sum := sha256.Sum256(key.Marshal())
+		fingerprint = sum[:]
+	default:
+		return false
+	}
+	recorded, err := hex.DecodeString(sshfp.FingerPrint)
+	return err == nil && bytes.Equal(recorded, fingerprint)
+}
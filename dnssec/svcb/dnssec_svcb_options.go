@@ -0,0 +1,25 @@
+package svcb
+
+type config struct {
+	noAddressLookup  bool
+	noOriginFallback bool
+}
+
+type Option func(*config)
+
+// WithoutAddressLookup makes the planner fill in the addresses of candidates
+// from the ipv4hint and ipv6hint parameters only, e.g. for a dialer resolving
+// them itself.
+func WithoutAddressLookup() Option {
+	return func(c *config) {
+		c.noAddressLookup = true
+	}
+}
+
+// WithoutOriginFallback makes the planner return only the endpoints of
+// ServiceMode records, without the origin itself as last resort.
+func WithoutOriginFallback() Option {
+	return func(c *config) {
+		c.noOriginFallback = true
+	}
+}
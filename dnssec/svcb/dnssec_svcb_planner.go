@@ -0,0 +1,274 @@
+// Package svcb plans connections from the SVCB and HTTPS records of DNSSEC
+// validated zones as described in [rfc9460].
+package svcb
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+)
+
+// MaxAliasChain bounds the AliasMode records followed for one service, see
+// [rfc9460] 3.
+const MaxAliasChain = 8
+
+// ErrServiceUnavailable is returned when an AliasMode record has the root as
+// TargetName, see [rfc9460] 2.5.1.
+var ErrServiceUnavailable = errors.New("service is not available")
+
+// Candidate is an endpoint of a service to connect to.
+type Candidate struct {
+	// Target is the host name to connect to and to use for TLS.
+	Target string
+	Port   uint16
+	// ALPN are the protocols the endpoint supports, in order of preference.
+	ALPN []string
+	// ECHConfigList is the Encrypted ClientHello configuration, if any.
+	ECHConfigList []byte
+	// IPs are the addresses of Target, or its address hints if they could
+	// not be looked up.
+	IPs      []net.IP
+	Priority uint16
+	// Origin is set for the fallback to the origin without SVCB records,
+	// which is the last alias target after AliasMode records.
+	Origin bool
+	// Status is Secure only if the records leading to the endpoint and its
+	// addresses are.
+	Status dnssec.SecurityStatus
+}
+
+// Planner turns SVCB and HTTPS records looked up through a validating
+// dnssec.Resolver into ordered connection candidates.
+type Planner struct {
+	config
+	resolver *dnssec.Resolver
+}
+
+func New(resolver *dnssec.Resolver, options ...Option) (planner *Planner, err error) {
+	planner = &Planner{resolver: resolver}
+	for _, opt := range options {
+		opt(&planner.config)
+	}
+	if resolver == nil {
+		err = fmt.Errorf("no DNSSEC resolver provided for creating SVCB planner")
+		return
+	}
+	return
+}
+
+// PlanHTTPS returns the candidates for the https URL of host and port from its
+// HTTPS records, see [rfc9460] 9.1. The default protocol is http/1.1.
+func (planner *Planner) PlanHTTPS(host string, port uint16) (candidates []Candidate, err error) {
+	name := dns.Fqdn(host)
+	if port != 443 {
+		name = "_" + strconv.Itoa(int(port)) + "._https." + name
+	}
+	return planner.Plan(name, dns.TypeHTTPS, host, port, []string{"http/1.1"})
+}
+
+// Plan returns the candidates of the SVCB or HTTPS records of qtype at name
+// for the origin host and port, ordered by priority. defaultALPN are the
+// protocols of the scheme every endpoint supports unless it has the
+// no-default-alpn parameter. Candidates whose addresses fail to be looked up
+// are left out; Plan only fails on them if no candidate is left.
+func (planner *Planner) Plan(name string, qtype uint16, host string, port uint16, defaultALPN []string) (candidates []Candidate, err error) {
+	owner := dns.Fqdn(name)
+	origin := dns.Fqdn(host)
+	var (
+		status  dnssec.SecurityStatus
+		records []*dns.SVCB
+	)
+	for i := 0; ; i++ {
+		var rrsStatus dnssec.SecurityStatus
+		if records, rrsStatus, err = planner.lookup(owner, qtype); err != nil {
+			return
+		}
+		if rrsStatus != dnssec.Secure {
+			status = rrsStatus
+		}
+		alias := aliasTarget(records)
+		if alias == "" {
+			break
+		}
+		if alias == "." {
+			err = fmt.Errorf("%w: %s", ErrServiceUnavailable, owner)
+			return
+		}
+		if i == MaxAliasChain {
+			err = fmt.Errorf("more than %d AliasMode records for %s", MaxAliasChain, name)
+			return
+		}
+		owner, origin = alias, alias
+	}
+
+	// [rfc9460] 2.4.1. ServiceMode records are tried by priority, the ones
+	// of the same priority in random order
+	rand.Shuffle(len(records), func(i, j int) {
+		records[i], records[j] = records[j], records[i]
+	})
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Priority < records[j].Priority
+	})
+	ech := false
+	for _, svcb := range records {
+		candidate, ok := newCandidate(svcb, owner, port, defaultALPN)
+		if !ok {
+			continue
+		}
+		candidate.Status = status
+		ech = ech || len(candidate.ECHConfigList) > 0
+		candidates = append(candidates, candidate)
+	}
+	// [rfc9460] 3. without usable records the origin is used, but not as
+	// fallback from endpoints with ECH, which would reveal the name. After
+	// AliasMode records the origin is the last alias target.
+	if !planner.noOriginFallback && !ech {
+		candidates = append(candidates, Candidate{
+			Target: origin,
+			Port:   port,
+			ALPN:   append([]string(nil), defaultALPN...),
+			Origin: true,
+			Status: status,
+		})
+	}
+	usable := candidates[:0]
+	var addressErr error
+	for _, candidate := range candidates {
+		if lookupErr := planner.addresses(&candidate); lookupErr != nil {
+			if addressErr == nil {
+				addressErr = lookupErr
+			}
+			continue
+		}
+		usable = append(usable, candidate)
+	}
+	if candidates = usable; len(candidates) == 0 {
+		candidates, err = nil, addressErr
+	}
+	return
+}
+
+// lookup returns the SVCB or HTTPS records at name, none if it has none.
+func (planner *Planner) lookup(name string, qtype uint16) (records []*dns.SVCB, status dnssec.SecurityStatus, err error) {
+	rrs, status, err := planner.resolver.LookupRRs(name, qtype)
+	if err = dnssec.IgnoreNotFound(err); err != nil {
+		err = fmt.Errorf("failed to look up %s records of %s: %w", dns.TypeToString[qtype], name, err)
+		return
+	}
+	for _, rr := range rrs {
+		switch rr := rr.(type) {
+		case *dns.SVCB:
+			records = append(records, rr)
+		case *dns.HTTPS:
+			records = append(records, &rr.SVCB)
+		}
+	}
+	return
+}
+
+// aliasTarget returns the TargetName of the AliasMode record of records if
+// there is one, which takes precedence over ServiceMode records, see
+// [rfc9460] 2.4.2.
+func aliasTarget(records []*dns.SVCB) string {
+	for _, svcb := range records {
+		if svcb.Priority == 0 {
+			return dns.CanonicalName(svcb.Target)
+		}
+	}
+	return ""
+}
+
+// newCandidate applies the SvcParams of the ServiceMode record svcb at owner,
+// rejecting records with mandatory keys the planner does not support, see
+// [rfc9460] 8.
+func newCandidate(svcb *dns.SVCB, owner string, port uint16, defaultALPN []string) (candidate Candidate, ok bool) {
+	candidate = Candidate{Target: svcb.Target, Port: port, Priority: svcb.Priority}
+	if candidate.Target == "." {
+		// [rfc9460] 2.5.2. the owner name, after following aliases
+		candidate.Target = owner
+	}
+	var alpn []string
+	noDefaultALPN := false
+	var hints []net.IP
+	for _, kv := range svcb.Value {
+		switch kv := kv.(type) {
+		case *dns.SVCBMandatory:
+			for _, key := range kv.Code {
+				if !supported(key) {
+					return
+				}
+			}
+		case *dns.SVCBAlpn:
+			alpn = kv.Alpn
+		case *dns.SVCBNoDefaultAlpn:
+			noDefaultALPN = true
+		case *dns.SVCBPort:
+			candidate.Port = kv.Port
+		case *dns.SVCBIPv4Hint:
+			hints = append(hints, kv.Hint...)
+		case *dns.SVCBIPv6Hint:
+			hints = append(hints, kv.Hint...)
+		case *dns.SVCBECHConfig:
+			candidate.ECHConfigList = kv.ECH
+		}
+	}
+	if noDefaultALPN && len(alpn) == 0 {
+		// [rfc9460] 7.1.1. no protocol left to use
+		return
+	}
+	candidate.ALPN = append(candidate.ALPN, alpn...)
+	if !noDefaultALPN {
+		for _, protocol := range defaultALPN {
+			if !contains(candidate.ALPN, protocol) {
+				candidate.ALPN = append(candidate.ALPN, protocol)
+			}
+		}
+	}
+	candidate.IPs = hints
+	ok = true
+	return
+}
+
+func supported(key dns.SVCBKey) bool {
+	switch key {
+	case dns.SVCB_ALPN, dns.SVCB_NO_DEFAULT_ALPN, dns.SVCB_PORT, dns.SVCB_IPV4HINT, dns.SVCB_ECHCONFIG, dns.SVCB_IPV6HINT:
+		return true
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// addresses replaces the address hints of candidate with the addresses of its
+// target unless the planner does not look them up. Hints are kept if the
+// target has no addresses, see [rfc9460] 7.3.
+func (planner *Planner) addresses(candidate *Candidate) (err error) {
+	if planner.noAddressLookup {
+		return
+	}
+	ips, status, err := planner.resolver.LookupIP("ip", candidate.Target)
+	if err = dnssec.IgnoreNotFound(err); err != nil {
+		err = fmt.Errorf("failed to look up addresses of %s: %w", candidate.Target, err)
+		return
+	}
+	if len(ips) > 0 {
+		candidate.IPs = ips
+	}
+	if status != dnssec.Secure {
+		candidate.Status = status
+	}
+	return
+}
@@ -0,0 +1,98 @@
+package svcb_test
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/n.v0/dnssec"
+	"gopkg.in/n.v0/dnssec/svcb"
+	"gopkg.in/n.v0/internal/dnstest"
+)
+
+func TestPlanHTTPS(t *testing.T) {
+	tree := dnstest.NewTree()
+	tree.AddZone("example.").Add(
+		"example. 300 IN HTTPS 2 svc2.example. alpn=h2 port=8443",
+		"example. 300 IN HTTPS 1 . alpn=h3,h2 ipv4hint=192.0.2.9",
+		"example. 300 IN HTTPS 3 svc3.example. mandatory=key65000 key65000=foo",
+		"example. 300 IN HTTPS 4 svc4.example. no-default-alpn",
+		"example. 300 IN A 192.0.2.1",
+		"svc2 300 IN A 192.0.2.2",
+		"alias 300 IN HTTPS 0 example.",
+		"cdn 300 IN HTTPS 0 plain.example.",
+		"gone 300 IN HTTPS 0 .",
+		"plain 300 IN A 192.0.2.3",
+		"_8080._https.plain 300 IN HTTPS 1 . no-default-alpn alpn=h2",
+		"private 300 IN HTTPS 1 ech.example. ech=AEX+DQBB",
+		"mixed 300 IN HTTPS 1 www.bogus. alpn=h2",
+		"broken 300 IN HTTPS 1 www.bogus. ech=AEX+DQBB",
+	)
+	tree.AddZone("bogus.").Add("www 300 IN A 192.0.2.4").Bogus = true
+	tree.AddZone("unsigned.").Add("www 300 IN HTTPS 0 example.").Unsigned = true
+	resolver, err := dnssec.New(
+		dnssec.WithTrustAnchors(tree.TrustAnchors()),
+		dnssec.WithDNSResolver(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	planner, err := svcb.New(resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	candidates, err := planner.PlanHTTPS("alias.example", 443)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 3 {
+		t.Fatalf("expected two endpoints and the origin, got %+v", candidates)
+	}
+	first, second, origin := candidates[0], candidates[1], candidates[2]
+	if first.Target != "example." || first.Port != 443 || len(first.ALPN) != 3 || first.ALPN[0] != "h3" || first.ALPN[2] != "http/1.1" {
+		t.Errorf("expected owner of alias target with default ALPN, got %+v", first)
+	}
+	if len(first.IPs) != 1 || first.IPs[0].String() != "192.0.2.1" || first.Status != dnssec.Secure {
+		t.Errorf("expected looked up address to replace hint, got %+v", first)
+	}
+	if second.Target != "svc2.example." || second.Port != 8443 || second.Priority != 2 {
+		t.Errorf("expected port override, got %+v", second)
+	}
+	if !origin.Origin || origin.Target != "example." || origin.Port != 443 {
+		t.Errorf("expected origin fallback to the alias target, got %+v", origin)
+	}
+
+	// an alias target with only address records is the origin
+	candidates, err = planner.PlanHTTPS("cdn.example.", 443)
+	if err != nil || len(candidates) != 1 {
+		t.Fatalf("expected only the origin, got %+v %v", candidates, err)
+	}
+	if origin = candidates[0]; !origin.Origin || origin.Target != "plain.example." || len(origin.IPs) != 1 || origin.IPs[0].String() != "192.0.2.3" {
+		t.Errorf("expected alias target as origin with its addresses, got %+v", origin)
+	}
+
+	if candidates, err = planner.PlanHTTPS("plain.example.", 8080); err != nil || len(candidates) != 2 {
+		t.Fatalf("expected port prefixed endpoint and origin, got %+v %v", candidates, err)
+	}
+	if alpn := candidates[0].ALPN; len(alpn) != 1 || alpn[0] != "h2" {
+		t.Errorf("expected no default ALPN, got %v", alpn)
+	}
+	if candidates, err = planner.PlanHTTPS("plain.example.", 443); err != nil || len(candidates) != 1 || !candidates[0].Origin {
+		t.Errorf("expected only origin without HTTPS RRs, got %+v %v", candidates, err)
+	}
+	if candidates, err = planner.PlanHTTPS("private.example.", 443); err != nil || len(candidates) != 1 || len(candidates[0].ECHConfigList) == 0 {
+		t.Errorf("expected no origin fallback with ECH, got %+v %v", candidates, err)
+	}
+	if candidates, err = planner.PlanHTTPS("mixed.example.", 443); err != nil || len(candidates) != 1 || !candidates[0].Origin {
+		t.Errorf("expected endpoint with bogus addresses to be skipped, got %+v %v", candidates, err)
+	}
+	if candidates, err = planner.PlanHTTPS("broken.example.", 443); !errors.Is(err, dnssec.ErrBogus) || candidates != nil {
+		t.Errorf("expected bogus addresses without usable candidate to fail, got %+v %v", candidates, err)
+	}
+	if _, err = planner.PlanHTTPS("gone.example.", 443); !errors.Is(err, svcb.ErrServiceUnavailable) {
+		t.Errorf("expected unavailable service, got %v", err)
+	}
+	if candidates, err = planner.PlanHTTPS("www.unsigned.", 443); err != nil || len(candidates) == 0 || candidates[0].Status != dnssec.ErrInsecure {
+		t.Errorf("expected insecure alias to taint candidates, got %+v %v", candidates, err)
+	}
+}
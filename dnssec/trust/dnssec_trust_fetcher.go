@@ -14,7 +14,7 @@ import (
 )
 
 var (
-	cachedRootKeys      map[uint16]*dns.DNSKEY
+	cachedRootKeys      dnssec.KeySet
 	cachedRootKeysMutex sync.RWMutex
 )
 
@@ -37,14 +37,14 @@ func NewRootTrustFetcher(options ...Option) (fetcher *RootTrustFetcher, err erro
 	return
 }
 
-func (rtf *RootTrustFetcher) FetchVerifyRootKeys() (rootKeys map[uint16]*dns.DNSKEY, err error) {
+func (rtf *RootTrustFetcher) FetchVerifyRootKeys() (rootKeys dnssec.KeySet, err error) {
 	var (
 		msg                   *dns.Msg
 		trustAnchors          TrustAnchor
 		trustAnchorsXML       []byte
 		trustAnchorsSignature []byte
 		trustAnchorsP7        *pkcs7.PKCS7
-		trustKeyDigests       map[uint16]*KeyDigest
+		trustKeyDigests       map[uint16][]*KeyDigest
 	)
 
 	cachedRootKeysMutex.RLock()
@@ -74,14 +74,14 @@ func (rtf *RootTrustFetcher) FetchVerifyRootKeys() (rootKeys map[uint16]*dns.DNS
 	}
 
 	// filter out invalid trust anchors by valid time ranges
-	trustKeyDigests = make(map[uint16]*KeyDigest)
+	trustKeyDigests = make(map[uint16][]*KeyDigest)
 	for i := range trustAnchors.KeyDigest {
 		keyDigest := &trustAnchors.KeyDigest[i]
 		if err = keyDigest.Verify(); err != nil {
 			err = nil
 			continue
 		}
-		trustKeyDigests[keyDigest.KeyTag] = keyDigest
+		trustKeyDigests[keyDigest.KeyTag] = append(trustKeyDigests[keyDigest.KeyTag], keyDigest)
 	}
 
 	msg = new(dns.Msg)
@@ -91,14 +91,15 @@ func (rtf *RootTrustFetcher) FetchVerifyRootKeys() (rootKeys map[uint16]*dns.DNS
 		return
 	}
 
-	rootKeys = make(map[uint16]*dns.DNSKEY)
+	rootKeys = dnssec.NewKeySet()
 
 	for _, ans := range msg.Answer {
 		if dnskey, ok := ans.(*dns.DNSKEY); ok {
-			if keyDigest, ok := trustKeyDigests[dnskey.KeyTag()]; ok {
+			// several keys and digests may share a key tag
+			for _, keyDigest := range trustKeyDigests[dnskey.KeyTag()] {
 				ds := dnskey.ToDS(keyDigest.DigestType)
-				if strings.EqualFold(ds.Digest, keyDigest.Digest) {
-					rootKeys[dnskey.KeyTag()] = dnskey
+				if ds != nil && strings.EqualFold(ds.Digest, keyDigest.Digest) {
+					rootKeys.Add(dnskey)
 				}
 			}
 		}
@@ -114,7 +115,7 @@ func (rtf *RootTrustFetcher) FetchVerifyRootKeys() (rootKeys map[uint16]*dns.DNS
 
 	for _, rr := range msg.Answer {
 		if dnskey, ok := rr.(*dns.DNSKEY); ok {
-			rootKeys[dnskey.KeyTag()] = dnskey
+			rootKeys.Add(dnskey)
 		}
 	}
 
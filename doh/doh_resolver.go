@@ -2,6 +2,7 @@ package doh
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -28,6 +29,11 @@ func New(options ...Option) (resolver *Resolver, err error) {
 }
 
 func (resolver *Resolver) Query(msg *dns.Msg) (resp *dns.Msg, err error) {
+	return resolver.QueryContext(context.Background(), msg)
+}
+
+// QueryContext is Query giving up once ctx is done.
+func (resolver *Resolver) QueryContext(ctx context.Context, msg *dns.Msg) (resp *dns.Msg, err error) {
 	var (
 		data    []byte
 		lastErr error
@@ -40,7 +46,7 @@ func (resolver *Resolver) Query(msg *dns.Msg) (resp *dns.Msg, err error) {
 		return
 	}
 	for _, server := range resolver.dohServers {
-		if resp, err = resolver.queryServer(server, data); err == nil {
+		if resp, err = resolver.queryServer(ctx, server, data); err == nil {
 			break
 		}
 		lastErr = err
@@ -51,9 +57,14 @@ func (resolver *Resolver) Query(msg *dns.Msg) (resp *dns.Msg, err error) {
 	return
 }
 
-func (resolver *Resolver) queryServer(server string, data []byte) (msg *dns.Msg, err error) {
+func (resolver *Resolver) queryServer(ctx context.Context, server string, data []byte) (msg *dns.Msg, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
 	var resp *http.Response
-	if resp, err = resolver.httpClient.Post(server, "application/dns-message", bytes.NewReader(data)); err != nil {
+	if resp, err = resolver.httpClient.Do(req); err != nil {
 		return
 	}
 	defer resp.Body.Close()
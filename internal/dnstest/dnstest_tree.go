@@ -0,0 +1,397 @@
+package dnstest
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+)
+
+// Tree is a hierarchy of zones under a signed root, answering queries like a
+// recursive resolver that does no validation itself.
+type Tree struct {
+	Root *Zone
+
+	mutex   sync.Mutex
+	zones   map[string]*Zone
+	queries []dns.Question
+
+	nextAddress net.IP
+}
+
+func NewTree() *Tree {
+	t := &Tree{zones: make(map[string]*Zone), nextAddress: net.IPv4(10, 53, 0, 1)}
+	t.Root = t.AddZone(".")
+	return t
+}
+
+// AddZone adds a signed zone. Set Unsigned or Bogus on the returned zone to
+// change how it is served.
+func (t *Tree) AddZone(name string) (z *Zone) {
+	z = &Zone{Name: dns.CanonicalName(name), tree: t}
+	z.generateKeys()
+	t.mutex.Lock()
+	z.address = t.nextAddress
+	t.nextAddress = net.IPv4(10, 53, t.nextAddress[14]+byte((int(t.nextAddress[15])+1)/256), byte(int(t.nextAddress[15])+1))
+	t.zones[z.Name] = z
+	t.mutex.Unlock()
+	return
+}
+
+// Resign replaces the keys of z with new ones using algorithm, and the DS RR
+// in its parent with one using digestType.
+func (t *Tree) Resign(z *Zone, algorithm, digestType uint8) {
+	t.mutex.Lock()
+	z.Algorithm, z.DigestType = algorithm, digestType
+	z.generateKeys()
+	t.mutex.Unlock()
+}
+
+// TrustAnchors returns the DNSKEY RRset of the root zone.
+func (t *Tree) TrustAnchors() dnssec.KeySet {
+	return dnssec.NewKeySet(t.Root.KSK, t.Root.ZSK)
+}
+
+// Queries returns the questions received so far.
+func (t *Tree) Queries() []dns.Question {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]dns.Question(nil), t.queries...)
+}
+
+func (t *Tree) ResetQueries() {
+	t.mutex.Lock()
+	t.queries = nil
+	t.mutex.Unlock()
+}
+
+func (t *Tree) Query(msg *dns.Msg) (resp *dns.Msg, err error) {
+	resp = new(dns.Msg)
+	resp.SetReply(msg)
+	resp.RecursionAvailable = true
+	if len(msg.Question) != 1 {
+		resp.Rcode = dns.RcodeFormatError
+		return
+	}
+	q := msg.Question[0]
+	do := false
+	if opt := msg.IsEdns0(); opt != nil {
+		do = opt.Do()
+		resp.SetEdns0(4096, do)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.queries = append(t.queries, q)
+	qname := dns.CanonicalName(q.Name)
+	if z := t.zoneForLocked(qname, q.Qtype); z != nil {
+		t.answerLocked(resp, z, qname, q.Qtype, do, time.Now(), 0, true)
+	} else {
+		resp.Rcode = dns.RcodeServerFailure
+	}
+	return
+}
+
+// Address returns the IP address of the name server of zone, which is
+// ns1.<zone> in the zone and in the glue of its parent.
+func (t *Tree) Address(zone string) string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if z := t.zones[dns.CanonicalName(zone)]; z != nil {
+		return z.address.String()
+	}
+	return ""
+}
+
+// Exchange sends msg to the authoritative name server at the address server,
+// which answers for its own zone only and refers to its child zones.
+func (t *Tree) Exchange(msg *dns.Msg, server string) (resp *dns.Msg, err error) {
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		host, err = server, nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var z *Zone
+	for _, zone := range t.zones {
+		if zone.address.String() == host {
+			z = zone
+		}
+	}
+	if z == nil {
+		err = fmt.Errorf("no name server at %s", server)
+		return
+	}
+
+	resp = new(dns.Msg)
+	resp.SetReply(msg)
+	if len(msg.Question) != 1 {
+		resp.Rcode = dns.RcodeFormatError
+		return
+	}
+	q := msg.Question[0]
+	do := false
+	if opt := msg.IsEdns0(); opt != nil {
+		do = opt.Do()
+		resp.SetEdns0(4096, do)
+	}
+	t.queries = append(t.queries, q)
+	qname := dns.CanonicalName(q.Name)
+	if !dns.IsSubDomain(z.Name, qname) {
+		resp.Rcode = dns.RcodeRefused
+		return
+	}
+
+	// refer to the child zone containing qname, except for DS queries at
+	// the apex of the child, which the parent answers itself
+	for name := qname; name != z.Name; name = parentName(name) {
+		child := t.zones[name]
+		if child == nil || child.parentLocked() != z || (q.Qtype == dns.TypeDS && name == qname) {
+			continue
+		}
+		ns := &dns.NS{
+			Hdr: dns.RR_Header{Name: child.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 3600},
+			Ns:  join("ns1", child.Name),
+		}
+		resp.Ns = append(resp.Ns, ns)
+		if do && !z.Unsigned && !child.Unsigned {
+			ds := []dns.RR{child.DS()}
+			resp.Ns = append(resp.Ns, ds[0], z.sign(ds, time.Now()))
+		}
+		resp.Extra = append(resp.Extra, child.glue())
+		return
+	}
+
+	resp.Authoritative = true
+	t.answerLocked(resp, z, qname, q.Qtype, do, time.Now(), 0, false)
+	return
+}
+
+func (t *Tree) zoneForLocked(qname string, qtype uint16) *Zone {
+	for name := qname; ; name = parentName(name) {
+		if z := t.zones[name]; z != nil && !(qtype == dns.TypeDS && name == qname && name != ".") {
+			return z
+		}
+		if name == "." {
+			return nil
+		}
+	}
+}
+
+func (t *Tree) answerLocked(resp *dns.Msg, z *Zone, qname string, qtype uint16, do bool, now time.Time, depth int, recursive bool) {
+	signed := do && !z.Unsigned
+	rrs := z.allRecordsLocked()
+	owners := make(map[string][]dns.RR)
+	for _, rr := range rrs {
+		owner := dns.CanonicalName(rr.Header().Name)
+		owners[owner] = append(owners[owner], rr)
+	}
+	addRRset := func(section *[]dns.RR, rrset []dns.RR) {
+		*section = append(*section, rrset...)
+		if signed && len(rrset) > 0 {
+			*section = append(*section, z.sign(rrset, now))
+		}
+	}
+
+	if set := filterType(owners[qname], qtype); len(set) > 0 {
+		addRRset(&resp.Answer, set)
+		return
+	}
+	if set := filterType(owners[qname], dns.TypeCNAME); len(set) > 0 {
+		addRRset(&resp.Answer, set)
+		target := dns.CanonicalName(set[0].(*dns.CNAME).Target)
+		if next := t.zoneForLocked(target, qtype); recursive && next != nil && depth < 8 {
+			t.answerLocked(resp, next, target, qtype, do, now, depth+1, recursive)
+		}
+		return
+	}
+
+	exists := false
+	for owner := range owners {
+		if dns.IsSubDomain(qname, owner) {
+			exists = true
+			break
+		}
+	}
+	if exists {
+		// NODATA
+		addRRset(&resp.Ns, []dns.RR{z.soa()})
+		if signed && z.NSEC3 {
+			addRRset(&resp.Ns, []dns.RR{z.nsec3Locked(owners, qname)})
+		} else if signed {
+			addRRset(&resp.Ns, []dns.RR{z.nsecLocked(owners, qname)})
+		}
+		return
+	}
+
+	closestEncloser := qname
+	for {
+		closestEncloser = parentName(closestEncloser)
+		found := closestEncloser == z.Name
+		for owner := range owners {
+			if dns.IsSubDomain(closestEncloser, owner) {
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	wildcard := join("*", closestEncloser)
+	if set := filterType(owners[wildcard], qtype); len(set) > 0 {
+		var synthesized []dns.RR
+		for _, rr := range set {
+			rr = dns.Copy(rr)
+			rr.Header().Name = qname
+			synthesized = append(synthesized, rr)
+		}
+		resp.Answer = append(resp.Answer, synthesized...)
+		if signed {
+			rrsig := z.sign(set, now)
+			rrsig.Hdr.Name = qname
+			resp.Answer = append(resp.Answer, rrsig)
+			if z.NSEC3 {
+				addRRset(&resp.Ns, []dns.RR{z.nsec3Locked(owners, nextCloser(closestEncloser, qname))})
+			} else {
+				addRRset(&resp.Ns, []dns.RR{z.nsecLocked(owners, qname)})
+			}
+		}
+		return
+	}
+
+	// NXDOMAIN
+	resp.Rcode = dns.RcodeNameError
+	addRRset(&resp.Ns, []dns.RR{z.soa()})
+	if signed && z.NSEC3 {
+		// [rfc5155] 7.2.2. closest encloser proof and wildcard
+		proof := []*dns.NSEC3{
+			z.nsec3Locked(owners, closestEncloser),
+			z.nsec3Locked(owners, nextCloser(closestEncloser, qname)),
+			z.nsec3Locked(owners, wildcard),
+		}
+		seen := make(map[string]bool)
+		for _, nsec3 := range proof {
+			if !seen[nsec3.Hdr.Name] {
+				seen[nsec3.Hdr.Name] = true
+				addRRset(&resp.Ns, []dns.RR{nsec3})
+			}
+		}
+	} else if signed {
+		nsec := z.nsecLocked(owners, qname)
+		addRRset(&resp.Ns, []dns.RR{nsec})
+		if wildcardNSEC := z.nsecLocked(owners, wildcard); wildcardNSEC.Hdr.Name != nsec.Hdr.Name {
+			addRRset(&resp.Ns, []dns.RR{wildcardNSEC})
+		}
+	}
+}
+
+// nsecLocked returns the NSEC RR owned by name, or the one covering it when
+// name does not exist in the zone.
+func (z *Zone) nsecLocked(owners map[string][]dns.RR, name string) *dns.NSEC {
+	names := make([]string, 0, len(owners))
+	for owner := range owners {
+		names = append(names, owner)
+	}
+	sort.Slice(names, func(i, j int) bool { return CanonicalLess(names[i], names[j]) })
+	i := sort.Search(len(names), func(i int) bool { return !CanonicalLess(names[i], name) })
+	if i == len(names) || names[i] != name {
+		i = (i - 1 + len(names)) % len(names)
+	}
+	owner := names[i]
+	nsec := &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: owner, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+		NextDomain: names[(i+1)%len(names)],
+	}
+	types := map[uint16]bool{dns.TypeNSEC: true, dns.TypeRRSIG: true}
+	for _, rr := range owners[owner] {
+		types[rr.Header().Rrtype] = true
+	}
+	for typ := range types {
+		nsec.TypeBitMap = append(nsec.TypeBitMap, typ)
+	}
+	sort.Slice(nsec.TypeBitMap, func(i, j int) bool { return nsec.TypeBitMap[i] < nsec.TypeBitMap[j] })
+	return nsec
+}
+
+// nsec3Locked returns the NSEC3 RR matching name, or the one covering it when
+// name does not exist in the zone. Empty non-terminals have NSEC3 RRs too.
+func (z *Zone) nsec3Locked(owners map[string][]dns.RR, name string) *dns.NSEC3 {
+	types := make(map[string]map[uint16]bool)
+	for owner, rrs := range owners {
+		for n := owner; dns.IsSubDomain(z.Name, n); n = parentName(n) {
+			if types[n] == nil {
+				types[n] = make(map[uint16]bool)
+			}
+			if n == z.Name {
+				break
+			}
+		}
+		for _, rr := range rrs {
+			types[owner][rr.Header().Rrtype] = true
+		}
+	}
+	hashes := make([]string, 0, len(types))
+	hashTypes := make(map[string]map[uint16]bool)
+	for n, t := range types {
+		h := dns.HashName(n, dns.SHA1, 0, "")
+		hashes = append(hashes, h)
+		hashTypes[h] = t
+	}
+	sort.Strings(hashes)
+	hash := dns.HashName(name, dns.SHA1, 0, "")
+	i := sort.SearchStrings(hashes, hash)
+	if i == len(hashes) || hashes[i] != hash {
+		i = (i - 1 + len(hashes)) % len(hashes)
+	}
+	nsec3 := &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: join(strings.ToLower(hashes[i]), z.Name), Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+		Hash:       dns.SHA1,
+		NextDomain: hashes[(i+1)%len(hashes)],
+		HashLength: 20,
+	}
+	for typ := range hashTypes[hashes[i]] {
+		nsec3.TypeBitMap = append(nsec3.TypeBitMap, typ)
+	}
+	if len(nsec3.TypeBitMap) > 0 {
+		nsec3.TypeBitMap = append(nsec3.TypeBitMap, dns.TypeRRSIG)
+	}
+	sort.Slice(nsec3.TypeBitMap, func(i, j int) bool { return nsec3.TypeBitMap[i] < nsec3.TypeBitMap[j] })
+	return nsec3
+}
+
+// nextCloser returns the name one label longer than closestEncloser on the
+// way to qname.
+func nextCloser(closestEncloser, qname string) string {
+	name := qname
+	for parentName(name) != closestEncloser {
+		name = parentName(name)
+	}
+	return name
+}
+
+func filterType(rrs []dns.RR, typ uint16) (out []dns.RR) {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == typ {
+			out = append(out, rr)
+		}
+	}
+	return
+}
+
+// CanonicalLess reports whether a sorts before b in the canonical DNS name
+// order of [rfc4034] 6.1.
+func CanonicalLess(a, b string) bool {
+	la, lb := dns.SplitDomainName(strings.ToLower(a)), dns.SplitDomainName(strings.ToLower(b))
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if la[i] != lb[j] {
+			return la[i] < lb[j]
+		}
+	}
+	return len(la) < len(lb)
+}
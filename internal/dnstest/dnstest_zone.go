@@ -0,0 +1,208 @@
+// Package dnstest serves a tree of in-memory DNS zones, signed with freshly
+// generated keys, for testing DNSSEC validation without network access.
+package dnstest
+
+import (
+	"crypto"
+	"encoding/base64"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Zone is an authoritative zone in a Tree.
+type Zone struct {
+	Name string
+
+	// Unsigned zones carry no DNSSEC records and have no DS in their parent.
+	Unsigned bool
+
+	// Bogus zones publish a DS and DNSKEY RRset that verify correctly but
+	// serve corrupted signatures for every other RRset.
+	Bogus bool
+
+	// NSEC3 zones deny existence with NSEC3 RRs without salt or additional
+	// iterations instead of NSEC RRs.
+	NSEC3 bool
+
+	KSK, ZSK *dns.DNSKEY
+
+	// Algorithm and DigestType used for the keys of the zone and the DS RR
+	// in its parent. They can be changed with Tree.Resign.
+	Algorithm  uint8
+	DigestType uint8
+
+	kskPriv, zskPriv crypto.Signer
+
+	tree    *Tree
+	records []dns.RR
+	address net.IP
+}
+
+// Add parses records in zone file format and adds them to the zone. Relative
+// owner names are completed with the zone name.
+func (z *Zone) Add(records ...string) *Zone {
+	for _, s := range records {
+		rr, err := dns.NewRR("$ORIGIN " + z.Name + "\n" + s)
+		if err != nil {
+			panic(err)
+		}
+		z.AddRR(rr)
+	}
+	return z
+}
+
+func (z *Zone) AddRR(rrs ...dns.RR) *Zone {
+	z.tree.mutex.Lock()
+	z.records = append(z.records, rrs...)
+	z.tree.mutex.Unlock()
+	return z
+}
+
+func (z *Zone) generateKeys() {
+	if z.Algorithm == 0 {
+		z.Algorithm = dns.ECDSAP256SHA256
+	}
+	if z.DigestType == 0 {
+		z.DigestType = dns.SHA256
+	}
+	z.KSK, z.kskPriv = generateKey(z.Name, dns.ZONE|dns.SEP, z.Algorithm)
+	z.ZSK, z.zskPriv = generateKey(z.Name, dns.ZONE, z.Algorithm)
+}
+
+func generateKey(zone string, flags uint16, algorithm uint8) (key *dns.DNSKEY, priv crypto.Signer) {
+	key = &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: algorithm,
+	}
+	bits := 256
+	switch algorithm {
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
+		bits = 1024
+	case dns.ECDSAP384SHA384:
+		bits = 384
+	}
+	k, err := key.Generate(bits)
+	if err != nil {
+		panic(err)
+	}
+	priv = k.(crypto.Signer)
+	return
+}
+
+// glue returns the address record of the name server of the zone.
+func (z *Zone) glue() *dns.A {
+	return &dns.A{
+		Hdr: dns.RR_Header{Name: join("ns1", z.Name), Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 3600},
+		A:   z.address,
+	}
+}
+
+// DS returns the DS RR published for the zone in its parent.
+func (z *Zone) DS() *dns.DS {
+	return z.KSK.ToDS(z.DigestType)
+}
+
+func (z *Zone) soa() *dns.SOA {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: z.Name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+		Ns:      join("ns1", z.Name),
+		Mbox:    join("hostmaster", z.Name),
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  300,
+	}
+}
+
+// allRecordsLocked returns the records of the zone including the apex
+// records and the delegations to its children.
+func (z *Zone) allRecordsLocked() (rrs []dns.RR) {
+	rrs = append(rrs, z.soa(), &dns.NS{
+		Hdr: dns.RR_Header{Name: z.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 3600},
+		Ns:  join("ns1", z.Name),
+	})
+	if !z.Unsigned {
+		rrs = append(rrs, z.KSK, z.ZSK)
+	}
+	if z.Name != "." {
+		rrs = append(rrs, z.glue())
+	}
+	for _, child := range z.tree.zones {
+		if child.parentLocked() != z {
+			continue
+		}
+		rrs = append(rrs, &dns.NS{
+			Hdr: dns.RR_Header{Name: child.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 3600},
+			Ns:  join("ns1", child.Name),
+		})
+		if !child.Unsigned {
+			rrs = append(rrs, child.DS())
+		}
+	}
+	rrs = append(rrs, z.records...)
+	return
+}
+
+func (z *Zone) parentLocked() *Zone {
+	if z.Name == "." {
+		return nil
+	}
+	for name := parentName(z.Name); ; name = parentName(name) {
+		if parent := z.tree.zones[name]; parent != nil {
+			return parent
+		}
+	}
+}
+
+func (z *Zone) sign(rrset []dns.RR, now time.Time) (rrsig *dns.RRSIG) {
+	key, priv := z.ZSK, z.zskPriv
+	if rrset[0].Header().Rrtype == dns.TypeDNSKEY {
+		key, priv = z.KSK, z.kskPriv
+	}
+	hdr := rrset[0].Header()
+	labels := dns.CountLabel(hdr.Name)
+	if strings.HasPrefix(hdr.Name, "*.") {
+		labels--
+	}
+	rrsig = &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: hdr.Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: hdr.Ttl},
+		TypeCovered: hdr.Rrtype,
+		Algorithm:   key.Algorithm,
+		Labels:      uint8(labels),
+		OrigTtl:     hdr.Ttl,
+		Expiration:  uint32(now.Add(24 * time.Hour).Unix()),
+		Inception:   uint32(now.Add(-time.Hour).Unix()),
+		KeyTag:      key.KeyTag(),
+		SignerName:  z.Name,
+	}
+	if err := rrsig.Sign(priv, rrset); err != nil {
+		panic(err)
+	}
+	if z.Bogus && rrsig.TypeCovered != dns.TypeDNSKEY {
+		sig, _ := base64.StdEncoding.DecodeString(rrsig.Signature)
+		sig[len(sig)/2] ^= 1
+		rrsig.Signature = base64.StdEncoding.EncodeToString(sig)
+	}
+	return
+}
+
+func parentName(name string) string {
+	if name == "." {
+		return "."
+	}
+	i, _ := dns.NextLabel(name, 0)
+	return dns.Fqdn(name[i:])
+}
+
+func join(label, zone string) string {
+	if zone == "." {
+		return label + "."
+	}
+	return label + "." + zone
+}
@@ -0,0 +1,95 @@
+package iterative
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+)
+
+type config struct {
+	rootHints           []string
+	exchanger           Exchanger
+	trustAnchors        dnssec.KeySet
+	dnssecOptions       []dnssec.Option
+	noQNAMEMinimisation bool
+	maxDelegations      int
+}
+
+// Exchanger sends a query to the name server at the address server, given as
+// host and port, and returns its response.
+type Exchanger interface {
+	Exchange(msg *dns.Msg, server string) (resp *dns.Msg, err error)
+}
+
+// NetExchanger sends queries over UDP and retries them over TCP when the
+// response is truncated.
+type NetExchanger struct {
+	UDP *dns.Client
+	TCP *dns.Client
+}
+
+func NewNetExchanger(timeout time.Duration) *NetExchanger {
+	return &NetExchanger{
+		UDP: &dns.Client{Net: "udp", Timeout: timeout, UDPSize: 1232},
+		TCP: &dns.Client{Net: "tcp", Timeout: timeout},
+	}
+}
+
+func (e *NetExchanger) Exchange(msg *dns.Msg, server string) (resp *dns.Msg, err error) {
+	if resp, _, err = e.UDP.Exchange(msg, server); err != nil {
+		return
+	}
+	if resp.Truncated {
+		resp, _, err = e.TCP.Exchange(msg, server)
+	}
+	return
+}
+
+type Option func(*config)
+
+// WithRootHints replaces DefaultRootHints with the given IP addresses.
+func WithRootHints(addresses []string) Option {
+	return func(c *config) {
+		c.rootHints = append(c.rootHints, addresses...)
+	}
+}
+
+func WithExchanger(exchanger Exchanger) Option {
+	return func(c *config) {
+		c.exchanger = exchanger
+	}
+}
+
+// WithTrustAnchors makes the resolver validate every answer with a
+// dnssec.Resolver built on the given root keys, unless the query has the CD
+// bit set. Secure answers have the AD bit set, Bogus ones fail.
+func WithTrustAnchors(keys dnssec.KeySet) Option {
+	return func(c *config) {
+		c.trustAnchors = keys
+	}
+}
+
+// WithDNSSECOptions passes further options to the validating dnssec.Resolver.
+func WithDNSSECOptions(options ...dnssec.Option) Option {
+	return func(c *config) {
+		c.dnssecOptions = append(c.dnssecOptions, options...)
+	}
+}
+
+// WithoutQNAMEMinimisation sends the full query name to every name server
+// instead of only one label more than the zone it is authoritative for.
+func WithoutQNAMEMinimisation() Option {
+	return func(c *config) {
+		c.noQNAMEMinimisation = true
+	}
+}
+
+// WithMaxDelegations replaces DefaultMaxDelegations as the number of zone cuts
+// the resolver caches. The least recently used ones are evicted beyond it and
+// a value below 1 disables the cache.
+func WithMaxDelegations(n int) Option {
+	return func(c *config) {
+		c.maxDelegations = n
+	}
+}
@@ -0,0 +1,452 @@
+// Package iterative implements a recursive resolver which walks the DNS tree
+// itself, starting from the root name servers, instead of forwarding queries
+// to another recursive resolver.
+package iterative
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/dnssec"
+)
+
+const (
+	// maxReferrals bounds the referrals followed for a single name.
+	maxReferrals = 32
+
+	// maxDepth bounds the nesting of lookups for CNAME targets and for the
+	// addresses of name servers without glue.
+	maxDepth = 8
+
+	// [rfc9156] 2.3. MAX_MINIMISE_COUNT
+	maxMinimiseCount = 10
+
+	// maxDelegationTTL bounds how long a zone cut is cached, whatever the TTL
+	// of its NS RRset.
+	maxDelegationTTL = 24 * time.Hour
+)
+
+// DefaultMaxDelegations is the number of zone cuts cached by a Resolver unless
+// WithMaxDelegations changes it.
+const DefaultMaxDelegations = 10000
+
+var ErrLameDelegation = errors.New("lame delegation")
+
+// Resolver is an iterative resolver. It satisfies dnssec.DNSResolver, so it
+// can also be used by a dnssec.Resolver in place of a forwarding resolver.
+type Resolver struct {
+	config
+	validator *dnssec.Resolver
+
+	// delegations caches zone cuts until their NS RRset expires and evicts
+	// the least recently used ones beyond maxDelegations
+	mutex       sync.Mutex
+	delegations map[string]*list.Element
+	lru         *list.List
+}
+
+// delegation is a zone cut and the addresses of its name servers.
+type delegation struct {
+	cut     string
+	servers []string
+	expires time.Time
+}
+
+func New(options ...Option) (resolver *Resolver, err error) {
+	resolver = &Resolver{
+		config:      config{maxDelegations: DefaultMaxDelegations},
+		delegations: make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+	for _, opt := range options {
+		opt(&resolver.config)
+	}
+	if len(resolver.rootHints) == 0 {
+		resolver.rootHints = DefaultRootHints
+	}
+	if resolver.exchanger == nil {
+		resolver.exchanger = NewNetExchanger(2 * time.Second)
+	}
+	if resolver.trustAnchors != nil {
+		options := append([]dnssec.Option{
+			dnssec.WithTrustAnchors(resolver.trustAnchors),
+			dnssec.WithDNSResolver(iterator{resolver}),
+		}, resolver.dnssecOptions...)
+		if resolver.validator, err = dnssec.New(options...); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Validator returns the dnssec.Resolver validating the answers, or nil when
+// the resolver has no trust anchors.
+func (resolver *Resolver) Validator() *dnssec.Resolver {
+	return resolver.validator
+}
+
+// Query resolves the question of msg. With trust anchors the answer is
+// validated like dnssec.Resolver.Query does unless msg has the CD bit set:
+// Secure answers have the AD bit set, Insecure ones are returned as they are
+// and Bogus or Indeterminate ones return an error.
+func (resolver *Resolver) Query(msg *dns.Msg) (resp *dns.Msg, err error) {
+	if len(msg.Question) != 1 {
+		err = fmt.Errorf("query must have exactly one question, got %d", len(msg.Question))
+		return
+	}
+	if resolver.validator != nil {
+		// forwards queries with the CD bit set to the iterator
+		return resolver.validator.Query(msg)
+	}
+	q := msg.Question[0]
+	answer, err := resolver.resolve(q.Name, q.Qtype, 0)
+	if err != nil {
+		return
+	}
+
+	resp = new(dns.Msg)
+	resp.SetReply(msg)
+	resp.RecursionAvailable = true
+	resp.Rcode = answer.Rcode
+	do := false
+	if opt := msg.IsEdns0(); opt != nil {
+		do = opt.Do()
+	}
+	resp.Answer = dnssec.FilterDNSSEC(answer.Answer, q.Qtype, do)
+	resp.Ns = dnssec.FilterDNSSEC(answer.Ns, q.Qtype, do)
+	for _, rr := range answer.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			resp.Extra = append(resp.Extra, rr)
+		}
+	}
+	resp.Extra = dnssec.FilterDNSSEC(resp.Extra, q.Qtype, do)
+	if msg.IsEdns0() != nil {
+		resp.SetEdns0(4096, do)
+	}
+	return
+}
+
+// iterator resolves without validation for the dnssec.Resolver of a Resolver.
+type iterator struct {
+	resolver *Resolver
+}
+
+func (it iterator) Query(msg *dns.Msg) (resp *dns.Msg, err error) {
+	if len(msg.Question) != 1 {
+		err = fmt.Errorf("query must have exactly one question, got %d", len(msg.Question))
+		return
+	}
+	q := msg.Question[0]
+	resp, err = it.resolver.resolve(q.Name, q.Qtype, 0)
+	return
+}
+
+// resolve follows referrals from the closest known zone cut above name until
+// a name server answers authoritatively, then follows CNAME RRs in the
+// answer.
+func (resolver *Resolver) resolve(name string, qtype uint16, depth int) (resp *dns.Msg, err error) {
+	if depth > maxDepth {
+		err = fmt.Errorf("resolving %s: too many nested lookups", name)
+		return
+	}
+	qname := dns.CanonicalName(name)
+	zone, servers := resolver.closestDelegation(qname, qtype)
+
+	// [rfc9156] 3. the name servers of zone only learn one label more than
+	// their zone, asking for an A RR, until qname is reached
+	known := zone
+	minimise := !resolver.noQNAMEMinimisation
+	minimiseCount := 0
+	answered := false
+	for referrals := 0; referrals < maxReferrals; {
+		sendName, sendType := qname, qtype
+		if minimise && minimiseCount < maxMinimiseCount {
+			if next := childName(known, qname); next != qname {
+				sendName, sendType = next, dns.TypeA
+			}
+		}
+		if resp, err = resolver.exchange(zone, servers, sendName, sendType); err != nil {
+			return
+		}
+
+		if cut, ok := referral(resp, zone, sendName); ok {
+			if qtype == dns.TypeDS && cut == qname {
+				// the DS RRset of qname is served by the parent of the cut
+				err = fmt.Errorf("resolving %s DS: %w: referral to %s", qname, ErrLameDelegation, cut)
+				return
+			}
+			if servers, err = resolver.delegationServers(resp, zone, cut, depth); err != nil {
+				return
+			}
+			zone, known = cut, cut
+			referrals++
+			continue
+		}
+
+		if sendName != qname {
+			minimiseCount++
+			if resp.Rcode == dns.RcodeNameError {
+				// [rfc9156] 2.3. some name servers answer NXDOMAIN for
+				// empty non-terminals, so ask for the full name instead
+				minimise = false
+			}
+			known = sendName
+			continue
+		}
+		answered = true
+		break
+	}
+	if !answered {
+		err = fmt.Errorf("resolving %s: too many referrals", qname)
+		return
+	}
+
+	if qtype != dns.TypeCNAME {
+		err = resolver.followCNAME(resp, qname, qtype, depth)
+	}
+	return
+}
+
+// followCNAME resolves the target of a CNAME chain in resp which does not end
+// in the answer itself and appends its answer.
+func (resolver *Resolver) followCNAME(resp *dns.Msg, qname string, qtype uint16, depth int) (err error) {
+	target := qname
+	for i := 0; i < maxDepth; i++ {
+		next := ""
+		for _, rr := range resp.Answer {
+			if strings.EqualFold(rr.Header().Name, target) {
+				if rr.Header().Rrtype == qtype {
+					return
+				}
+				if cname, ok := rr.(*dns.CNAME); ok {
+					next = dns.CanonicalName(cname.Target)
+				}
+			}
+		}
+		if next == "" {
+			break
+		}
+		target = next
+	}
+	if target == qname {
+		return
+	}
+	chased, err := resolver.resolve(target, qtype, depth+1)
+	if err != nil {
+		return
+	}
+	resp.Answer = append(resp.Answer, chased.Answer...)
+	resp.Ns = chased.Ns
+	resp.Rcode = chased.Rcode
+	return
+}
+
+// exchange sends the question to the name servers of zone in turn until one
+// of them gives a usable answer.
+func (resolver *Resolver) exchange(zone string, servers []string, name string, qtype uint16) (resp *dns.Msg, err error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+	msg.RecursionDesired = false
+	msg.SetEdns0(1232, true)
+	err = fmt.Errorf("no name servers for %s", zone)
+	for _, server := range servers {
+		resp, err = resolver.exchanger.Exchange(msg, net.JoinHostPort(server, "53"))
+		if err != nil {
+			continue
+		}
+		if err = checkResponse(resp, zone, name); err == nil {
+			return
+		}
+	}
+	resp = nil
+	err = fmt.Errorf("querying name servers of %s for %s %s: %w", zone, name, dns.TypeToString[qtype], err)
+	return
+}
+
+// checkResponse reports a response which shows that the name server does not
+// serve zone, which RFC 1034 calls a lame delegation.
+func checkResponse(resp *dns.Msg, zone, name string) (err error) {
+	if len(resp.Question) != 1 || !strings.EqualFold(resp.Question[0].Name, name) {
+		err = fmt.Errorf("response to %s has a different question", name)
+		return
+	}
+	switch resp.Rcode {
+	case dns.RcodeSuccess, dns.RcodeNameError:
+	default:
+		err = fmt.Errorf("%w: %s", ErrLameDelegation, dns.RcodeToString[resp.Rcode])
+		return
+	}
+	if resp.Authoritative {
+		return
+	}
+	if _, ok := referral(resp, zone, name); !ok {
+		err = fmt.Errorf("%w: non-authoritative answer from name server of %s", ErrLameDelegation, zone)
+	}
+	return
+}
+
+// referral returns the zone cut resp refers to, which must be below zone and
+// at or above name. Upward and sideways referrals are ignored.
+func referral(resp *dns.Msg, zone, name string) (cut string, ok bool) {
+	if resp.Authoritative || len(resp.Answer) > 0 || resp.Rcode != dns.RcodeSuccess {
+		return
+	}
+	for _, rr := range resp.Ns {
+		if rr.Header().Rrtype != dns.TypeNS {
+			continue
+		}
+		owner := dns.CanonicalName(rr.Header().Name)
+		if owner != zone && dns.IsSubDomain(zone, owner) && dns.IsSubDomain(owner, name) {
+			cut, ok = owner, true
+			return
+		}
+	}
+	return
+}
+
+// delegationServers returns the addresses of the name servers of cut from a
+// referral by the name servers of zone. Glue is only trusted for names within
+// zone; the addresses of other name servers are resolved separately.
+func (resolver *Resolver) delegationServers(resp *dns.Msg, zone, cut string, depth int) (servers []string, err error) {
+	var (
+		names []string
+		ttl   uint32
+	)
+	for _, rr := range resp.Ns {
+		if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, cut) {
+			names = append(names, dns.CanonicalName(ns.Ns))
+			ttl = ns.Hdr.Ttl
+		}
+	}
+	var v6 []string
+	for _, name := range names {
+		if !dns.IsSubDomain(zone, name) {
+			continue
+		}
+		for _, rr := range resp.Extra {
+			if !strings.EqualFold(rr.Header().Name, name) {
+				continue
+			}
+			switch glue := rr.(type) {
+			case *dns.A:
+				servers = append(servers, glue.A.String())
+			case *dns.AAAA:
+				v6 = append(v6, glue.AAAA.String())
+			}
+		}
+	}
+	if len(servers)+len(v6) == 0 {
+		for _, name := range names {
+			if dns.IsSubDomain(cut, name) {
+				// needs glue, which the parent did not send
+				continue
+			}
+			var addresses *dns.Msg
+			if addresses, err = resolver.resolve(name, dns.TypeA, depth+1); err != nil {
+				continue
+			}
+			for _, rr := range addresses.Answer {
+				if a, ok := rr.(*dns.A); ok {
+					servers = append(servers, a.A.String())
+				}
+			}
+			if len(servers) > 0 {
+				break
+			}
+		}
+	}
+	servers = append(servers, v6...)
+	if len(servers) == 0 {
+		err = fmt.Errorf("%w: no addresses for the name servers of %s", ErrLameDelegation, cut)
+		return
+	}
+	err = nil
+	lifetime := time.Duration(ttl) * time.Second
+	if lifetime > maxDelegationTTL {
+		lifetime = maxDelegationTTL
+	}
+	resolver.addDelegation(delegation{cut: cut, servers: servers, expires: time.Now().Add(lifetime)})
+	return
+}
+
+// addDelegation caches d. When the cache is full, expired zone cuts are
+// dropped first and then the least recently used ones.
+func (resolver *Resolver) addDelegation(d delegation) {
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+	if resolver.maxDelegations < 1 {
+		return
+	}
+	if elem, ok := resolver.delegations[d.cut]; ok {
+		elem.Value = d
+		resolver.lru.MoveToFront(elem)
+		return
+	}
+	if resolver.lru.Len() >= resolver.maxDelegations {
+		now := time.Now()
+		for elem := resolver.lru.Back(); elem != nil; {
+			prev := elem.Prev()
+			if cached := elem.Value.(delegation); !now.Before(cached.expires) {
+				resolver.lru.Remove(elem)
+				delete(resolver.delegations, cached.cut)
+			}
+			elem = prev
+		}
+	}
+	for resolver.lru.Len() >= resolver.maxDelegations {
+		oldest := resolver.lru.Back()
+		resolver.lru.Remove(oldest)
+		delete(resolver.delegations, oldest.Value.(delegation).cut)
+	}
+	resolver.delegations[d.cut] = resolver.lru.PushFront(d)
+}
+
+// closestDelegation returns the deepest cached zone cut at which qname can be
+// resolved, falling back to the root hints. DS RRsets are served by the parent
+// of the zone cut at qname.
+func (resolver *Resolver) closestDelegation(qname string, qtype uint16) (zone string, servers []string) {
+	name := qname
+	if qtype == dns.TypeDS && name != "." {
+		name = parentName(name)
+	}
+	now := time.Now()
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+	for ; name != "."; name = parentName(name) {
+		if elem, ok := resolver.delegations[name]; ok {
+			if d := elem.Value.(delegation); now.Before(d.expires) {
+				resolver.lru.MoveToFront(elem)
+				zone, servers = name, d.servers
+				return
+			}
+			resolver.lru.Remove(elem)
+			delete(resolver.delegations, name)
+		}
+	}
+	zone, servers = ".", resolver.rootHints
+	return
+}
+
+// childName returns the name one label below ancestor on the way to name.
+func childName(ancestor, name string) string {
+	labels := dns.SplitDomainName(name)
+	n := dns.CountLabel(ancestor) + 1
+	if n >= len(labels) {
+		return name
+	}
+	return dns.Fqdn(strings.Join(labels[len(labels)-n:], "."))
+}
+
+func parentName(name string) string {
+	if name == "." {
+		return "."
+	}
+	i, _ := dns.NextLabel(name, 0)
+	return dns.Fqdn(name[i:])
+}
@@ -0,0 +1,190 @@
+package iterative_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"gopkg.in/n.v0/internal/dnstest"
+	"gopkg.in/n.v0/iterative"
+)
+
+// lameExchanger answers REFUSED for the address lame and passes every other
+// query to the tree.
+type lameExchanger struct {
+	tree *dnstest.Tree
+	lame string
+}
+
+func (e lameExchanger) Exchange(msg *dns.Msg, server string) (resp *dns.Msg, err error) {
+	if host, _, _ := net.SplitHostPort(server); host == e.lame {
+		resp = new(dns.Msg)
+		resp.SetRcode(msg, dns.RcodeRefused)
+		return
+	}
+	return e.tree.Exchange(msg, server)
+}
+
+func newTestTree() (tree *dnstest.Tree) {
+	tree = dnstest.NewTree()
+	tree.AddZone("com.")
+	tree.AddZone("example.com.").Add(
+		"www 300 IN A 192.0.2.1",
+		"alias 300 IN CNAME www.other.net.",
+	)
+	tree.AddZone("net.")
+	tree.AddZone("other.net.").Add("www 300 IN A 192.0.2.2")
+	tree.AddZone("unsigned.net.").Add("www 300 IN A 192.0.2.3").Unsigned = true
+	tree.AddZone("broken.com.").Add("www 300 IN A 192.0.2.4").Bogus = true
+	return
+}
+
+func query(resolver *iterative.Resolver, name string, qtype uint16, cd bool) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+	msg.SetEdns0(4096, true)
+	msg.CheckingDisabled = cd
+	return resolver.Query(msg)
+}
+
+func TestResolver(t *testing.T) {
+	tree := newTestTree()
+	resolver, err := iterative.New(
+		iterative.WithRootHints([]string{"192.0.2.53", tree.Address(".")}),
+		iterative.WithExchanger(lameExchanger{tree: tree, lame: "192.0.2.53"}),
+		iterative.WithTrustAnchors(tree.TrustAnchors()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := query(resolver, "www.example.com.", dns.TypeA, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.AuthenticatedData || len(resp.Answer) == 0 || resp.Answer[0].(*dns.A).A.String() != "192.0.2.1" {
+		t.Errorf("expected secure answer for www.example.com., got %v", resp)
+	}
+
+	resp, err = query(resolver, "www.unsigned.net.", dns.TypeA, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.AuthenticatedData || len(resp.Answer) == 0 {
+		t.Errorf("expected insecure answer for www.unsigned.net., got %v", resp)
+	}
+
+	if _, err = query(resolver, "www.broken.com.", dns.TypeA, false); err == nil {
+		t.Error("expected bogus answer for www.broken.com. to fail")
+	}
+	resp, err = query(resolver, "www.broken.com.", dns.TypeA, true)
+	if err != nil || resp.AuthenticatedData || len(resp.Answer) == 0 {
+		t.Errorf("expected unvalidated answer with CD bit, got %v %v", err, resp)
+	}
+
+	resp, err = query(resolver, "www.example.com.", dns.TypeAAAA, false)
+	if err != nil || len(resp.Answer) != 0 || !resp.AuthenticatedData {
+		t.Errorf("expected secure NODATA, got %v %v", err, resp)
+	}
+}
+
+func TestResolverCNAME(t *testing.T) {
+	tree := newTestTree()
+	resolver, err := iterative.New(
+		iterative.WithRootHints([]string{tree.Address(".")}),
+		iterative.WithExchanger(tree),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := query(resolver, "alias.example.com.", dns.TypeA, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var addresses []string
+	for _, rr := range resp.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			addresses = append(addresses, a.A.String())
+		}
+	}
+	if len(addresses) != 1 || addresses[0] != "192.0.2.2" {
+		t.Errorf("expected CNAME to be followed to 192.0.2.2, got %v", resp)
+	}
+}
+
+func TestQNAMEMinimisation(t *testing.T) {
+	for _, minimise := range []bool{true, false} {
+		tree := newTestTree()
+		options := []iterative.Option{
+			iterative.WithRootHints([]string{tree.Address(".")}),
+			iterative.WithExchanger(tree),
+		}
+		if !minimise {
+			options = append(options, iterative.WithoutQNAMEMinimisation())
+		}
+		resolver, err := iterative.New(options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = query(resolver, "www.example.com.", dns.TypeA, true); err != nil {
+			t.Fatal(err)
+		}
+		queries := tree.Queries()
+		if len(queries) == 0 {
+			t.Fatal("no queries sent")
+		}
+		first := queries[0]
+		if minimise && (first.Name != "com." || first.Qtype != dns.TypeA) {
+			t.Errorf("expected minimised query com. A to the root, got %v", first)
+		}
+		if !minimise && first.Name != "www.example.com." {
+			t.Errorf("expected full query name to the root, got %v", first)
+		}
+	}
+}
+
+func TestLameDelegation(t *testing.T) {
+	tree := newTestTree()
+	resolver, err := iterative.New(
+		iterative.WithRootHints([]string{tree.Address(".")}),
+		iterative.WithExchanger(lameExchanger{tree: tree, lame: tree.Address("example.com.")}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = query(resolver, "www.example.com.", dns.TypeA, true); !errors.Is(err, iterative.ErrLameDelegation) {
+		t.Errorf("expected ErrLameDelegation, got %v", err)
+	}
+}
+
+func TestMaxDelegations(t *testing.T) {
+	tree := newTestTree()
+	resolver, err := iterative.New(
+		iterative.WithRootHints([]string{tree.Address(".")}),
+		iterative.WithExchanger(tree),
+		iterative.WithMaxDelegations(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"www.example.com.", "www.other.net.", "www.example.com."} {
+		tree.ResetQueries()
+		if _, err = query(resolver, name, dns.TypeA, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the zone cuts of net. and other.net. evicted those of com. and
+	// example.com., so the resolver starts at the root again
+	if queries := tree.Queries(); len(queries) == 0 || queries[0].Name != "com." {
+		t.Errorf("expected resolution to restart at the root, got %v", queries)
+	}
+
+	tree.ResetQueries()
+	if _, err = query(resolver, "www.example.com.", dns.TypeA, true); err != nil {
+		t.Fatal(err)
+	}
+	if queries := tree.Queries(); len(queries) != 1 || queries[0].Name != "www.example.com." {
+		t.Errorf("expected a single query to the cached zone cut, got %v", queries)
+	}
+}